@@ -1,11 +1,15 @@
 package detector
 
 import (
+	"context"
+	"strconv"
 	"sync"
+	"time"
 
 	"github.com/hashicorp/go-multierror"
 	"github.com/pkg/errors"
 	"github.com/solo-io/gloo-api/pkg/api/types/v1"
+	"github.com/solo-io/gloo-function-discovery/internal/metrics"
 	"github.com/solo-io/gloo-function-discovery/pkg/backoff"
 	"github.com/solo-io/gloo-function-discovery/pkg/resolver"
 	"github.com/solo-io/gloo-plugins/kubernetes"
@@ -13,7 +17,38 @@ import (
 	"github.com/solo-io/gloo/pkg/log"
 )
 
-const maxRetries = 3
+// AnnotationKeyForceDetection set to "true" makes the next sync detect the
+// upstream, even if it was already detected. it is removed once detection succeeds
+const AnnotationKeyForceDetection = "gloo.solo.io/force_detection"
+
+func ForceDetection(us *v1.Upstream) bool {
+	if us.Metadata == nil {
+		return false
+	}
+	force, _ := strconv.ParseBool(us.Metadata.Annotations[AnnotationKeyForceDetection])
+	return force
+}
+
+// Schedule configures when upstreams are detected again
+type Schedule struct {
+	// upstreams that were already detected are detected again after this long.
+	// 0 disables re-detection
+	RedetectInterval time.Duration
+	// wait before detecting an upstream again after detection failed. the wait
+	// grows with each consecutive failure
+	FailureCooldown backoff.Policy
+}
+
+type detectionState struct {
+	// time of the last successful detection
+	detected time.Time
+	// consecutive failed detections
+	failures int
+	// no detection until then, after a failure
+	cooldownUntil time.Time
+	// whether the force annotation was seen on the last attempt
+	forced bool
+}
 
 // detectors detect a specific type of functional service
 // if they detect the service, they return service info and
@@ -24,94 +59,271 @@ type Interface interface {
 	DetectFunctionalService(us *v1.Upstream, addr string) (*v1.ServiceInfo, map[string]string, error)
 }
 
+// NamedDetector is a detector with the name of the factory that created it, which
+// identifies the detector in errors, detections and metrics
+type NamedDetector struct {
+	Name string
+	Interface
+}
+
+// SecretConsumer is implemented by detectors that need secrets to detect an
+// upstream, so that the secrets are watched before detection runs
+type SecretConsumer interface {
+	SecretRefs(us *v1.Upstream) []string
+}
+
+// GarbageCollector is implemented by detectors that store resources for the
+// upstreams they detect, so the resources can be deleted with the upstreams
+type GarbageCollector interface {
+	// deletes the resources of upstreams that are not in the list
+	CollectGarbage(upstreams []*v1.Upstream) error
+}
+
 // marker marks the upstream as functional. this modifies the upstream it was received,
 // so should not be called concurrently from multiple goroutines
 type Marker struct {
-	detectors []Interface
+	detectors []NamedDetector
 	resolver  resolver.Resolver
+	policy    backoff.Policy
+	// bounds the retries of each detector, so that a detector that keeps failing
+	// doesn't hold up the choice between the others
+	timeout  time.Duration
+	schedule Schedule
+	// default for upstreams without the policy annotation
+	conflictPolicy ConflictPolicy
 
-	finishedOrFailed map[string]int
-	m                sync.RWMutex
+	states map[string]*detectionState
+	m      sync.Mutex
 }
 
-func NewMarker(detectors []Interface, resolver resolver.Resolver) *Marker {
+// NewMarker creates a marker for the detectors, in order of priority. each detector
+// is retried with policy for at most timeout, 0 leaves the retries to the policy
+func NewMarker(detectors []NamedDetector, resolver resolver.Resolver, policy backoff.Policy, timeout time.Duration, schedule Schedule, conflictPolicy ConflictPolicy) *Marker {
 	return &Marker{
-		detectors:        detectors,
-		resolver:         resolver,
-		finishedOrFailed: make(map[string]int),
+		detectors:      detectors,
+		resolver:       resolver,
+		policy:         policy,
+		timeout:        timeout,
+		schedule:       schedule,
+		conflictPolicy: conflictPolicy,
+		states:         make(map[string]*detectionState),
 	}
 }
 
+// SecretRefs returns the refs of the secrets the detectors need for the upstreams
+func (m *Marker) SecretRefs(upstreams []*v1.Upstream) []string {
+	var refs []string
+	for _, d := range m.detectors {
+		consumer, ok := d.Interface.(SecretConsumer)
+		if !ok {
+			continue
+		}
+		for _, us := range upstreams {
+			refs = append(refs, consumer.SecretRefs(us)...)
+		}
+	}
+	return refs
+}
+
+// CollectGarbage deletes the resources the detectors stored for upstreams
+// that are not in the list, which must contain every upstream
+func (m *Marker) CollectGarbage(upstreams []*v1.Upstream) error {
+	existing := make(map[string]bool)
+	for _, us := range upstreams {
+		existing[us.Name] = true
+	}
+	m.m.Lock()
+	for name := range m.states {
+		if !existing[name] {
+			delete(m.states, name)
+		}
+	}
+	m.m.Unlock()
+
+	var errs error
+	for _, d := range m.detectors {
+		collector, ok := d.Interface.(GarbageCollector)
+		if !ok {
+			continue
+		}
+		if err := collector.CollectGarbage(upstreams); err != nil {
+			errs = multierror.Append(errs, errors.Wrapf(err, "%v detector", d.Name))
+		}
+	}
+	return errs
+}
+
 // should only be called for k8s, consul, and service type upstreams
 func (m *Marker) DetectFunctionalUpstream(us *v1.Upstream) (*v1.ServiceInfo, map[string]string, error) {
 	if us.Type != kubernetes.UpstreamTypeKube && us.Type != service.UpstreamTypeService {
 		// don't run detection for these types of upstreams
 		return nil, nil, nil
 	}
-	if us.ServiceInfo != nil {
+	if len(m.detectors) == 0 {
 		return nil, nil, nil
-		// this upstream has already been marked, skip it
 	}
 
-	m.m.RLock()
-	// tried this upstream
-	already := m.finishedOrFailed[us.Name]
-	m.m.RUnlock()
-	if already >= maxRetries {
-		log.Debugf("no more retries for %s", us.Name)
+	if !m.shouldDetect(us) {
 		return nil, nil, nil
 	}
 
-	m.m.Lock()
-	m.finishedOrFailed[us.Name]++
-	m.m.Unlock()
-
 	addr, err := m.resolver.Resolve(us)
 	if err != nil {
+		m.recordFailure(us.Name)
 		return nil, nil, errors.Wrapf(err, "resolving address for %v", us.Name)
 	}
 
-	stop := make(chan struct{})
-	failed := make(chan error)
+	policy, err := m.conflictPolicyFor(us)
+	if err != nil {
+		m.recordFailure(us.Name)
+		return nil, nil, err
+	}
 
-	serviceInfoC := make(chan *v1.ServiceInfo)
-	annotationsC := make(chan map[string]string)
+	chosen, errs := m.detect(us, addr, policy)
+	if chosen == nil {
+		m.recordFailure(us.Name)
+		return nil, nil, errors.Errorf("service type detection failed for %s: %v", us.Name, errs)
+	}
+	m.recordSuccess(us.Name)
+	log.Debugf("%v detector chosen for %v by %v policy", chosen.Detector, us.Name, policy)
+	return chosen.ServiceInfo, chosen.Annotations, nil
+}
 
-	// try every possible detector concurrently
-	for _, d := range m.detectors {
-		go func(d Interface) {
-			err := backoff.WithBackoff(func() error {
+// Detection is the result of one detector for an upstream
+type Detection struct {
+	Detector    string
+	ServiceInfo *v1.ServiceInfo
+	Annotations map[string]string
+	Err         error
+}
+
+// detect returns the detection chosen by the policy, or the errors of the detectors
+func (m *Marker) detect(us *v1.Upstream, addr string, policy ConflictPolicy) (*Detection, error) {
+	var (
+		chosen *Detection
+		errs   error
+	)
+	results := m.runDetectors(us, addr, func(results []*Detection) bool {
+		var decided bool
+		chosen, decided, errs = choose(policy, results)
+		return decided
+	})
+	if chosen != nil || errs != nil {
+		return chosen, errs
+	}
+	for _, result := range results {
+		if result != nil && result.Err != nil {
+			errs = multierror.Append(errs, result.Err)
+		}
+	}
+	return nil, errs
+}
+
+// runDetectors runs the detectors concurrently. done is called with the
+// results so far, in priority order, whenever a detector finishes. once it
+// returns true the remaining detectors are stopped
+func (m *Marker) runDetectors(us *v1.Upstream, addr string, done func([]*Detection) bool) []*Detection {
+	type indexed struct {
+		index     int
+		detection *Detection
+	}
+	// buffered so that detectors finishing after a decision don't block
+	finished := make(chan indexed, len(m.detectors))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for i, d := range m.detectors {
+		go func(i int, d NamedDetector) {
+			result := &Detection{Detector: d.Name}
+			detectorCtx := ctx
+			if m.timeout > 0 {
+				var cancelDetector context.CancelFunc
+				detectorCtx, cancelDetector = context.WithTimeout(ctx, m.timeout)
+				defer cancelDetector()
+			}
+			var lastErr error
+			result.Err = backoff.Retry(detectorCtx, m.policy, func() error {
+				metrics.DetectionAttempts.WithLabelValues(result.Detector).Inc()
 				serviceInfo, annotations, err := d.DetectFunctionalService(us, addr)
 				if err != nil {
+					lastErr = err
 					return err
 				}
-				// success
-				close(stop)
-				serviceInfoC <- serviceInfo
-				annotationsC <- annotations
-				m.m.Lock()
-				m.finishedOrFailed[us.Name] = maxRetries
-				m.m.Unlock()
+				metrics.DetectionSuccesses.WithLabelValues(result.Detector).Inc()
+				result.ServiceInfo, result.Annotations = serviceInfo, annotations
 				return nil
-			}, stop)
-			if err != nil {
-				failed <- err
+			})
+			if result.Err == context.DeadlineExceeded && lastErr != nil {
+				result.Err = errors.Wrapf(lastErr, "%v detector gave up after %v", result.Detector, m.timeout)
 			}
-		}(d)
+			finished <- indexed{index: i, detection: result}
+		}(i, d)
 	}
-	var totalFailed int
 
-	var errs error
-	for {
-		select {
-		case <-stop:
-			return <-serviceInfoC, <-annotationsC, nil
-		case err := <-failed:
-			errs = multierror.Append(errs, err)
-			totalFailed++
-			if totalFailed >= len(m.detectors) {
-				return nil, nil, errors.Errorf("service type detection failed for %s: %v", us.Name, errs)
-			}
+	results := make([]*Detection, len(m.detectors))
+	for range m.detectors {
+		result := <-finished
+		results[result.index] = result.detection
+		if done(results) {
+			// decided, stop the other detectors
+			break
 		}
 	}
+	return results
+}
+
+func (m *Marker) shouldDetect(us *v1.Upstream) bool {
+	now := time.Now()
+	forced := ForceDetection(us)
+
+	m.m.Lock()
+	defer m.m.Unlock()
+	state, ok := m.states[us.Name]
+	if !ok {
+		state = &detectionState{}
+		// detected before we started, wait a full interval
+		if us.ServiceInfo != nil {
+			state.detected = now
+		}
+		m.states[us.Name] = state
+	}
+	// newly forced, forget about earlier failures
+	if forced && !state.forced {
+		state.failures = 0
+		state.cooldownUntil = time.Time{}
+	}
+	state.forced = forced
+
+	if now.Before(state.cooldownUntil) {
+		log.Debugf("skipping detection for %s until %v after %v failures", us.Name, state.cooldownUntil, state.failures)
+		return false
+	}
+	if forced || us.ServiceInfo == nil {
+		return true
+	}
+	// this upstream has already been marked, detect it again if it's time
+	return m.schedule.RedetectInterval > 0 && now.Sub(state.detected) >= m.schedule.RedetectInterval
+}
+
+func (m *Marker) recordSuccess(usName string) {
+	m.m.Lock()
+	defer m.m.Unlock()
+	state, ok := m.states[usName]
+	if !ok {
+		return
+	}
+	state.detected = time.Now()
+	state.failures = 0
+	state.cooldownUntil = time.Time{}
+}
+
+func (m *Marker) recordFailure(usName string) {
+	m.m.Lock()
+	defer m.m.Unlock()
+	state, ok := m.states[usName]
+	if !ok {
+		return
+	}
+	state.failures++
+	state.cooldownUntil = time.Now().Add(m.schedule.FailureCooldown.Interval(state.failures))
 }
@@ -1,12 +1,15 @@
 package detector_test
 
 import (
+	"time"
+
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	"github.com/pkg/errors"
 
 	"github.com/solo-io/gloo-api/pkg/api/types/v1"
 	. "github.com/solo-io/gloo-function-discovery/internal/detector"
+	"github.com/solo-io/gloo-function-discovery/pkg/backoff"
 	"github.com/solo-io/gloo-function-discovery/pkg/resolver"
 	"github.com/solo-io/gloo-testing/helpers"
 )
@@ -15,10 +18,10 @@ var _ = Describe("Marker", func() {
 	Context("happy path", func() {
 		It("marks the upstream with the service info", func() {
 			resolve := resolver.NewResolver(nil)
-			marker := NewMarker([]Interface{
-				&mockDetector{id: "failing", triesBeforeSucceding: 50},
-				&mockDetector{id: "succeeding", triesBeforeSucceding: 3},
-			}, resolve)
+			marker := NewMarker([]NamedDetector{
+				{Name: "failing", Interface: &mockDetector{id: "failing", triesBeforeSucceding: 50}},
+				{Name: "succeeding", Interface: &mockDetector{id: "succeeding", triesBeforeSucceding: 3}},
+			}, resolve, backoff.DefaultPolicy(), 0, Schedule{}, PolicyFastest)
 			us := helpers.NewTestUpstream2()
 			svcInfo, annotations, err := marker.DetectFunctionalUpstream(us)
 			Expect(err).NotTo(HaveOccurred())
@@ -27,6 +30,55 @@ var _ = Describe("Marker", func() {
 			Expect(totalTries).To(BeNumerically(">=", 5))
 		})
 	})
+	Context("re-detection", func() {
+		var (
+			resolve = resolver.NewResolver(nil)
+			once    = backoff.Policy{MaxAttempts: 1}
+		)
+		detected := func(annotations map[string]string) *v1.Upstream {
+			us := helpers.NewTestUpstream2()
+			us.ServiceInfo = &v1.ServiceInfo{Type: "mock_service"}
+			us.Metadata = &v1.Metadata{Annotations: annotations}
+			return us
+		}
+		It("skips detected upstreams until the interval has passed", func() {
+			marker := NewMarker([]NamedDetector{{Name: "succeeding", Interface: &mockDetector{id: "succeeding"}}}, resolve, once, 0, Schedule{RedetectInterval: 50 * time.Millisecond}, PolicyPriority)
+			us := detected(nil)
+			svcInfo, _, err := marker.DetectFunctionalUpstream(us)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(svcInfo).To(BeNil())
+
+			time.Sleep(60 * time.Millisecond)
+			svcInfo, _, err = marker.DetectFunctionalUpstream(us)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(svcInfo).To(Equal(&v1.ServiceInfo{Type: "mock_service"}))
+		})
+		It("detects upstreams with the force annotation", func() {
+			marker := NewMarker([]NamedDetector{{Name: "succeeding", Interface: &mockDetector{id: "succeeding"}}}, resolve, once, 0, Schedule{}, PolicyPriority)
+			svcInfo, _, err := marker.DetectFunctionalUpstream(detected(map[string]string{AnnotationKeyForceDetection: "true"}))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(svcInfo).To(Equal(&v1.ServiceInfo{Type: "mock_service"}))
+		})
+		It("waits for the cooldown after a failure", func() {
+			d := &mockDetector{id: "flaky", triesBeforeSucceding: 2}
+			marker := NewMarker([]NamedDetector{{Name: "flaky", Interface: d}}, resolve, once, 0, Schedule{
+				FailureCooldown: backoff.Policy{InitialInterval: 50 * time.Millisecond},
+			}, PolicyPriority)
+			us := helpers.NewTestUpstream2()
+			_, _, err := marker.DetectFunctionalUpstream(us)
+			Expect(err).To(HaveOccurred())
+
+			// cooling down
+			svcInfo, _, err := marker.DetectFunctionalUpstream(us)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(svcInfo).To(BeNil())
+
+			time.Sleep(60 * time.Millisecond)
+			svcInfo, _, err = marker.DetectFunctionalUpstream(us)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(svcInfo).To(Equal(&v1.ServiceInfo{Type: "mock_service"}))
+		})
+	})
 })
 
 var totalTries int
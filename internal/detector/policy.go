@@ -0,0 +1,102 @@
+package detector
+
+import (
+	"github.com/pkg/errors"
+
+	"github.com/solo-io/gloo-api/pkg/api/types/v1"
+)
+
+// AnnotationKeyDetectionPolicy overrides the ConflictPolicy for an upstream
+const AnnotationKeyDetectionPolicy = "gloo.solo.io/detection_policy"
+
+// ConflictPolicy chooses which detection to apply when more than one detector
+// recognizes an upstream. detectors are prioritized in the order they are
+// configured in
+type ConflictPolicy string
+
+const (
+	// apply the detection of the highest priority detector that succeeds
+	PolicyPriority ConflictPolicy = "priority"
+	// apply the detection of the detector that succeeds first
+	PolicyFastest ConflictPolicy = "fastest"
+	// run every detector, and apply nothing if they detect different service types
+	PolicyStrict ConflictPolicy = "strict"
+)
+
+var policies = []ConflictPolicy{PolicyPriority, PolicyFastest, PolicyStrict}
+
+func ParseConflictPolicy(s string) (ConflictPolicy, error) {
+	for _, policy := range policies {
+		if string(policy) == s {
+			return policy, nil
+		}
+	}
+	return "", errors.Errorf("unknown detection policy %q, must be one of %v", s, policies)
+}
+
+func (m *Marker) conflictPolicyFor(us *v1.Upstream) (ConflictPolicy, error) {
+	if us.Metadata == nil || us.Metadata.Annotations[AnnotationKeyDetectionPolicy] == "" {
+		if m.conflictPolicy == "" {
+			return PolicyPriority, nil
+		}
+		return m.conflictPolicy, nil
+	}
+	policy, err := ParseConflictPolicy(us.Metadata.Annotations[AnnotationKeyDetectionPolicy])
+	if err != nil {
+		return "", errors.Wrapf(err, "invalid value for annotation %v", AnnotationKeyDetectionPolicy)
+	}
+	return policy, nil
+}
+
+// choose applies the policy to the results of the detectors so far, in
+// priority order, with nil for detectors that are still running.
+// decided is false until the results are enough to apply the policy
+func choose(policy ConflictPolicy, results []*Detection) (chosen *Detection, decided bool, err error) {
+	switch policy {
+	case PolicyFastest:
+		for _, result := range results {
+			if result != nil && result.Err == nil {
+				return result, true, nil
+			}
+		}
+	case PolicyPriority:
+		for _, result := range results {
+			if result == nil {
+				// a higher priority detector is still running
+				return nil, false, nil
+			}
+			if result.Err == nil {
+				return result, true, nil
+			}
+		}
+	case PolicyStrict:
+		for _, result := range results {
+			if result == nil {
+				return nil, false, nil
+			}
+			if result.Err != nil {
+				continue
+			}
+			if chosen == nil {
+				chosen = result
+				continue
+			}
+			if result.ServiceInfo.GetType() != chosen.ServiceInfo.GetType() {
+				return nil, true, errors.Errorf("detectors %v and %v disagree on the service type (%v, %v). "+
+					"set the %v annotation to %q to apply the detection of the detector configured first",
+					chosen.Detector, result.Detector, chosen.ServiceInfo.GetType(), result.ServiceInfo.GetType(),
+					AnnotationKeyDetectionPolicy, PolicyPriority)
+			}
+		}
+		if chosen != nil {
+			return chosen, true, nil
+		}
+	}
+	// decided once every detector has failed
+	for _, result := range results {
+		if result == nil {
+			return nil, false, nil
+		}
+	}
+	return nil, true, nil
+}
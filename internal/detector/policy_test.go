@@ -0,0 +1,115 @@
+package detector_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+
+	"github.com/solo-io/gloo-api/pkg/api/types/v1"
+	. "github.com/solo-io/gloo-function-discovery/internal/detector"
+	"github.com/solo-io/gloo-function-discovery/pkg/backoff"
+	"github.com/solo-io/gloo-function-discovery/pkg/resolver"
+	"github.com/solo-io/gloo-testing/helpers"
+)
+
+type typedDetector struct {
+	serviceType string
+	delay       time.Duration
+	fail        bool
+}
+
+func (d *typedDetector) DetectFunctionalService(_ *v1.Upstream, _ string) (*v1.ServiceInfo, map[string]string, error) {
+	time.Sleep(d.delay)
+	if d.fail {
+		return nil, nil, errors.Errorf("not %v", d.serviceType)
+	}
+	return &v1.ServiceInfo{Type: d.serviceType}, nil, nil
+}
+
+// detectors are named after the type they detect
+func named(d *typedDetector) NamedDetector {
+	return NamedDetector{Name: d.serviceType, Interface: d}
+}
+
+var _ = Describe("ConflictPolicy", func() {
+	var (
+		resolve   = resolver.NewResolver(nil)
+		once      = backoff.Policy{MaxAttempts: 1}
+		detectors []NamedDetector
+	)
+	BeforeEach(func() {
+		// the slow detector has the highest priority
+		detectors = []NamedDetector{
+			named(&typedDetector{serviceType: "slow", delay: 50 * time.Millisecond}),
+			named(&typedDetector{serviceType: "fast"}),
+		}
+	})
+	detect := func(policy ConflictPolicy, us *v1.Upstream) (*v1.ServiceInfo, error) {
+		svcInfo, _, err := NewMarker(detectors, resolve, once, 0, Schedule{}, policy).DetectFunctionalUpstream(us)
+		return svcInfo, err
+	}
+	It("applies the highest priority detection", func() {
+		svcInfo, err := detect(PolicyPriority, helpers.NewTestUpstream2())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(svcInfo.Type).To(Equal("slow"))
+	})
+	It("falls back to lower priority detectors", func() {
+		detectors[0].Interface.(*typedDetector).fail = true
+		svcInfo, err := detect(PolicyPriority, helpers.NewTestUpstream2())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(svcInfo.Type).To(Equal("fast"))
+	})
+	It("applies the fastest detection", func() {
+		svcInfo, err := detect(PolicyFastest, helpers.NewTestUpstream2())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(svcInfo.Type).To(Equal("fast"))
+	})
+	It("applies nothing when strict detectors disagree", func() {
+		_, err := detect(PolicyStrict, helpers.NewTestUpstream2())
+		Expect(err).To(HaveOccurred())
+	})
+	It("chooses between the detections of several detectors", func() {
+		detectors = []NamedDetector{
+			named(&typedDetector{serviceType: "nats", fail: true}),
+			named(&typedDetector{serviceType: "rest", delay: 20 * time.Millisecond}),
+			named(&typedDetector{serviceType: "grpc"}),
+		}
+		svcInfo, err := detect(PolicyPriority, helpers.NewTestUpstream2())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(svcInfo.Type).To(Equal("rest"))
+
+		svcInfo, err = detect(PolicyFastest, helpers.NewTestUpstream2())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(svcInfo.Type).To(Equal("grpc"))
+
+		_, err = detect(PolicyStrict, helpers.NewTestUpstream2())
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("rest"))
+		Expect(err.Error()).To(ContainSubstring("grpc"))
+		Expect(err.Error()).To(ContainSubstring(`to "priority"`))
+
+		detectors[2] = named(&typedDetector{serviceType: "rest"})
+		svcInfo, err = detect(PolicyStrict, helpers.NewTestUpstream2())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(svcInfo.Type).To(Equal("rest"))
+	})
+	It("stops waiting for a higher priority detector that keeps failing", func() {
+		detectors[0] = named(&typedDetector{serviceType: "retrying", fail: true})
+		retrying := backoff.Policy{InitialInterval: 10 * time.Millisecond}
+		marker := NewMarker(detectors, resolve, retrying, 100*time.Millisecond, Schedule{}, PolicyPriority)
+		start := time.Now()
+		svcInfo, _, err := marker.DetectFunctionalUpstream(helpers.NewTestUpstream2())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(svcInfo.Type).To(Equal("fast"))
+		Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+	})
+	It("reads the policy from the upstream annotation", func() {
+		us := helpers.NewTestUpstream2()
+		us.Metadata = &v1.Metadata{Annotations: map[string]string{AnnotationKeyDetectionPolicy: string(PolicyFastest)}}
+		svcInfo, err := detect(PolicyPriority, us)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(svcInfo.Type).To(Equal("fast"))
+	})
+})
@@ -0,0 +1,151 @@
+package detector
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/solo-io/gloo-storage/dependencies"
+	"github.com/solo-io/gloo/pkg/secretwatcher"
+	"github.com/spf13/pflag"
+
+	"github.com/solo-io/gloo-function-discovery/pkg/resolver"
+)
+
+// Factory creates a type of detector. each factory declares its name, the
+// flags it can be configured with, and a config object that doubles as the
+// schema for its section in the config file
+type Factory interface {
+	// unique name of the detector, used in the config file
+	Name() string
+	// pointer to the detector's config. flags are bound to it, and config file
+	// sections are decoded into it after flags are parsed
+	Config() interface{}
+	// registers the detector's flags, including whether it is enabled
+	AddFlags(flags *pflag.FlagSet)
+	// whether the detector was enabled by flag
+	Enabled() bool
+	// creates the detector from its config
+	New(deps Dependencies) (Interface, error)
+}
+
+// Dependencies are the shared clients detectors may need
+type Dependencies struct {
+	Resolver resolver.Resolver
+	// file storage is only created if a detector needs it
+	Files func() (dependencies.FileStorage, error)
+	// the most recent secrets, for detectors that are a SecretConsumer
+	Secrets func() secretwatcher.SecretMap
+}
+
+// Duration is a time.Duration that is written as a string, e.g. "5s", in the
+// config file
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return errors.Wrap(err, "duration must be a string, e.g. \"5s\"")
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// Section configures a detector in the config file
+type Section struct {
+	Name string `json:"name"`
+	// defaults to true for listed detectors
+	Enabled *bool `json:"enabled,omitempty"`
+	// decoded into the detector's config
+	Config map[string]interface{} `json:"config,omitempty"`
+}
+
+// Registry holds the available detector factories, in their default order
+type Registry struct {
+	factories []Factory
+}
+
+func NewRegistry(factories ...Factory) *Registry {
+	return &Registry{factories: factories}
+}
+
+func (r *Registry) AddFlags(flags *pflag.FlagSet) {
+	for _, f := range r.factories {
+		f.AddFlags(flags)
+	}
+}
+
+// Detectors creates the enabled detectors. if sections are provided, only the
+// detectors they list are created, in the order they are listed. otherwise the
+// detectors enabled by flag are created in the default order
+func (r *Registry) Detectors(sections []Section, deps Dependencies) ([]NamedDetector, error) {
+	var enabled []Factory
+	if len(sections) == 0 {
+		for _, f := range r.factories {
+			if f.Enabled() {
+				enabled = append(enabled, f)
+			}
+		}
+	}
+	seen := make(map[string]bool)
+	for _, section := range sections {
+		f := r.Factory(section.Name)
+		if f == nil {
+			return nil, errors.Errorf("unknown detector %v", section.Name)
+		}
+		if seen[section.Name] {
+			return nil, errors.Errorf("detector %v configured more than once", section.Name)
+		}
+		seen[section.Name] = true
+		if section.Enabled != nil && !*section.Enabled {
+			continue
+		}
+		if err := decodeConfig(section.Config, f.Config()); err != nil {
+			return nil, errors.Wrapf(err, "invalid config for detector %v", section.Name)
+		}
+		enabled = append(enabled, f)
+	}
+
+	var detectors []NamedDetector
+	for _, f := range enabled {
+		d, err := f.New(deps)
+		if err != nil {
+			return nil, errors.Wrapf(err, "creating detector %v", f.Name())
+		}
+		detectors = append(detectors, NamedDetector{Name: f.Name(), Interface: d})
+	}
+	return detectors, nil
+}
+
+// Factory returns the factory with the name, or nil
+func (r *Registry) Factory(name string) Factory {
+	for _, f := range r.factories {
+		if f.Name() == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// decodes the config file section on top of the values set by flags
+func decodeConfig(section map[string]interface{}, config interface{}) error {
+	if len(section) == 0 {
+		return nil
+	}
+	b, err := json.Marshal(section)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(config)
+}
@@ -0,0 +1,73 @@
+package detector_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/spf13/pflag"
+
+	. "github.com/solo-io/gloo-function-discovery/internal/detector"
+)
+
+type mockConfig struct {
+	Enabled bool   `json:"-"`
+	ID      string `json:"id"`
+}
+
+type mockFactory struct {
+	name   string
+	config mockConfig
+}
+
+func (f *mockFactory) Name() string        { return f.name }
+func (f *mockFactory) Config() interface{} { return &f.config }
+func (f *mockFactory) Enabled() bool       { return f.config.Enabled }
+func (f *mockFactory) AddFlags(flags *pflag.FlagSet) {
+	flags.BoolVar(&f.config.Enabled, "detect-"+f.name+"-upstreams", true, "")
+	flags.StringVar(&f.config.ID, f.name+"-id", f.name, "")
+}
+func (f *mockFactory) New(_ Dependencies) (Interface, error) {
+	return &mockDetector{id: f.config.ID}, nil
+}
+
+func ids(detectors []NamedDetector) []string {
+	var ids []string
+	for _, d := range detectors {
+		ids = append(ids, d.Name+":"+d.Interface.(*mockDetector).id)
+	}
+	return ids
+}
+
+var _ = Describe("Registry", func() {
+	var (
+		registry *Registry
+		flags    *pflag.FlagSet
+	)
+	BeforeEach(func() {
+		registry = NewRegistry(&mockFactory{name: "a"}, &mockFactory{name: "b"}, &mockFactory{name: "c"})
+		flags = pflag.NewFlagSet("test", pflag.ContinueOnError)
+		registry.AddFlags(flags)
+	})
+	It("creates the detectors enabled by flag in default order", func() {
+		Expect(flags.Parse([]string{"--detect-b-upstreams=false", "--c-id=custom"})).To(Succeed())
+		detectors, err := registry.Detectors(nil, Dependencies{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ids(detectors)).To(Equal([]string{"a:a", "c:custom"}))
+	})
+	It("enables, orders and configures detectors from config sections", func() {
+		Expect(flags.Parse(nil)).To(Succeed())
+		disabled := false
+		detectors, err := registry.Detectors([]Section{
+			{Name: "c", Config: map[string]interface{}{"id": "from-config"}},
+			{Name: "b", Enabled: &disabled},
+			{Name: "a"},
+		}, Dependencies{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ids(detectors)).To(Equal([]string{"c:from-config", "a:a"}))
+	})
+	It("rejects unknown detectors and config fields", func() {
+		_, err := registry.Detectors([]Section{{Name: "missing"}}, Dependencies{})
+		Expect(err).To(HaveOccurred())
+		_, err = registry.Detectors([]Section{{Name: "a", Config: map[string]interface{}{"typo": 1}}}, Dependencies{})
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -1,6 +1,8 @@
 package eventloop
 
 import (
+	"context"
+	"sync"
 	"time"
 
 	"github.com/pkg/errors"
@@ -10,12 +12,21 @@ import (
 	"github.com/solo-io/gloo-api/pkg/api/types/v1"
 	"github.com/solo-io/gloo-function-discovery/internal/detector"
 	"github.com/solo-io/gloo-function-discovery/internal/grpc"
-	"github.com/solo-io/gloo-function-discovery/internal/openfaas"
+	"github.com/solo-io/gloo-function-discovery/internal/health"
+	"github.com/solo-io/gloo-function-discovery/internal/metrics"
 	"github.com/solo-io/gloo-function-discovery/internal/nats-streaming"
+	"github.com/solo-io/gloo-function-discovery/internal/openfaas"
 	"github.com/solo-io/gloo-function-discovery/internal/options"
 	"github.com/solo-io/gloo-function-discovery/internal/swagger"
 	"github.com/solo-io/gloo-function-discovery/internal/updater"
+	"github.com/solo-io/gloo-function-discovery/internal/updater/gcf"
+	updatergrpc "github.com/solo-io/gloo-function-discovery/internal/updater/grpc"
+	"github.com/solo-io/gloo-function-discovery/internal/updater/lambda"
+	updaternats "github.com/solo-io/gloo-function-discovery/internal/updater/nats"
+	updaterfaas "github.com/solo-io/gloo-function-discovery/internal/updater/openfaas"
+	updaterswagger "github.com/solo-io/gloo-function-discovery/internal/updater/swagger"
 	"github.com/solo-io/gloo-function-discovery/internal/upstreamwatcher"
+	"github.com/solo-io/gloo-function-discovery/pkg/functiontypes"
 	"github.com/solo-io/gloo-function-discovery/pkg/resolver"
 	"github.com/solo-io/gloo-storage"
 	"github.com/solo-io/gloo-storage/consul"
@@ -26,6 +37,7 @@ import (
 	"github.com/solo-io/gloo-storage/dependencies/kube"
 	"github.com/solo-io/gloo-storage/file"
 	"github.com/solo-io/gloo/pkg/bootstrap"
+	"github.com/solo-io/gloo/pkg/filewatcher"
 	"github.com/solo-io/gloo/pkg/log"
 	"github.com/solo-io/gloo/pkg/secretwatcher"
 	filesecrets "github.com/solo-io/gloo/pkg/secretwatcher/file"
@@ -42,7 +54,83 @@ type workItem struct {
 	secrets  secretwatcher.SecretMap
 }
 
-func Run(opts bootstrap.Options, discoveryOpts options.DiscoveryOptions, stop <-chan struct{}, errs chan error) error {
+// latestSecrets shares the most recent secrets with the detectors, which run
+// in the worker goroutines
+type latestSecrets struct {
+	secrets secretwatcher.SecretMap
+	m       sync.RWMutex
+}
+
+func (l *latestSecrets) set(secrets secretwatcher.SecretMap) {
+	l.m.Lock()
+	l.secrets = secrets
+	l.m.Unlock()
+}
+
+func (l *latestSecrets) get() secretwatcher.SecretMap {
+	l.m.RLock()
+	defer l.m.RUnlock()
+	return l.secrets
+}
+
+// latestFiles shares the most recent watched files with the function sources
+type latestFiles struct {
+	files filewatcher.Files
+	m     sync.RWMutex
+}
+
+func (l *latestFiles) set(files filewatcher.Files) {
+	l.m.Lock()
+	l.files = files
+	l.m.Unlock()
+}
+
+func (l *latestFiles) get() filewatcher.Files {
+	l.m.RLock()
+	defer l.m.RUnlock()
+	return l.files
+}
+
+// DefaultDetectors returns a registry of all the available detectors. swaggerDocs is
+// the cache the swagger detector shares docs through, and may be nil
+func DefaultDetectors(swaggerDocs *updaterswagger.DocCache) *detector.Registry {
+	return detector.NewRegistry(
+		nats.NewFactory(),
+		openfaas.NewFactory(),
+		swagger.NewFactory(swaggerDocs),
+		grpc.NewFactory(),
+	)
+}
+
+// sourceDependencies are what the function sources are created with
+type sourceDependencies struct {
+	resolve       resolver.Resolver
+	files         func() filewatcher.Files
+	swaggerDocs   *updaterswagger.DocCache
+	swaggerFilter *updaterswagger.OperationFilter
+	swaggerFetch  updaterswagger.FetchOptions
+	discoveryOpts options.DiscoveryOptions
+}
+
+// functionSources creates every function source, in order of precedence
+func functionSources(deps sourceDependencies) []functiontypes.FunctionSource {
+	return []functiontypes.FunctionSource{
+		lambda.NewFunctionSource(),
+		gcf.NewFunctionSource(),
+		updaterswagger.NewFunctionSource(deps.swaggerDocs, deps.files, deps.swaggerFilter, deps.swaggerFetch),
+		updaterfaas.NewFunctionSource(deps.resolve),
+		updaternats.NewFunctionSource(deps.resolve, deps.discoveryOpts.NatsMonitoringPort),
+		updatergrpc.NewFunctionSource(deps.resolve, deps.files, deps.discoveryOpts.GRPCReflectionTimeout),
+	}
+}
+
+// FunctionSourceNames returns the names of every function source, which are
+// all enabled by default
+func FunctionSourceNames() []string {
+	return functiontypes.Names(functionSources(sourceDependencies{}))
+}
+
+func Run(opts bootstrap.Options, discoveryOpts options.DiscoveryOptions, detectorRegistry *detector.Registry, swaggerDocs *updaterswagger.DocCache, checker *health.Checker, stop <-chan struct{}, errs chan error) error {
 	store, err := createStorageClient(opts)
 	if err != nil {
 		return errors.Wrap(err, "failed to create config store client")
@@ -53,6 +141,18 @@ func Run(opts bootstrap.Options, discoveryOpts options.DiscoveryOptions, stop <-
 		return errors.Wrap(err, "failed to start monitoring upstreams")
 	}
 
+	initialUpstreams, err := store.V1().Upstreams().List()
+	if err != nil {
+		checker.MarkFailed(health.ComponentStorage, err)
+		errs <- errors.Wrap(err, "listing upstreams")
+	} else {
+		checker.MarkSynced(health.ComponentStorage)
+		// the watcher only sends non-empty lists, so there is nothing to wait for
+		if len(initialUpstreams) == 0 {
+			checker.MarkSynced(health.ComponentUpstreams)
+		}
+	}
+
 	secretWatcher, err := setupSecretWatcher(opts, stop)
 	if err != nil {
 		return errors.Wrap(err, "failed to set up secret watcher")
@@ -60,28 +160,76 @@ func Run(opts bootstrap.Options, discoveryOpts options.DiscoveryOptions, stop <-
 
 	resolve := createResolver(opts)
 
-	var detectors []detector.Interface
-	if discoveryOpts.AutoDiscoverNATS {
-		//TODO: support cluster ids
-		detectors = append(detectors, nats.NewNatsDetector(""))
+	// the detectors and the file watcher share a file storage client, created on first use
+	var (
+		fileStore     dependencies.FileStorage
+		fileStoreErr  error
+		fileStoreOnce sync.Once
+	)
+	fileStorage := func() (dependencies.FileStorage, error) {
+		fileStoreOnce.Do(func() {
+			fileStore, fileStoreErr = createFileStorageClient(opts)
+		})
+		return fileStore, fileStoreErr
+	}
+	watchedFiles := &latestFiles{}
+	var (
+		fileUpdates <-chan filewatcher.Files
+		fileErrs    <-chan error
+	)
+	fileWatcher, err := setupFileWatcher(fileStorage, stop)
+	if err != nil {
+		log.Warnf("swagger docs in file storage will not be discovered: %v", err)
+	} else {
+		fileUpdates, fileErrs = fileWatcher.Files(), fileWatcher.Error()
 	}
 
-	if discoveryOpts.AutoDiscoverFAAS {
-		detectors = append(detectors, openfaas.NewFaasDetector())
+	cfg, err := options.LoadConfigFile(discoveryOpts.ConfigFile)
+	if err != nil {
+		return err
 	}
 
-	if discoveryOpts.AutoDiscoverSwagger {
-		detectors = append(detectors, swagger.NewSwaggerDetector(discoveryOpts.SwaggerUrisToTry))
+	latest := &latestSecrets{}
+	detectors, err := detectorRegistry.Detectors(cfg.Detectors, detector.Dependencies{
+		Resolver: resolve,
+		Files:    fileStorage,
+		Secrets:  latest.get,
+	})
+	if err != nil {
+		return errors.Wrap(err, "creating detectors")
 	}
-	if discoveryOpts.AutoDiscoverGRPC {
-		files, err := createFileStorageClient(opts)
-		if err != nil {
-			return errors.Wrap(err, "creating file storage client")
-		}
-		detectors = append(detectors, grpc.NewGRPCDetector(files))
+
+	// detected swagger docs are fetched with the headers the detector found them with
+	swaggerFetch, err := swagger.FetchOptionsFrom(detectorRegistry)
+	if err != nil {
+		return err
 	}
 
-	marker := detector.NewMarker(detectors, resolve)
+	sources, err := functiontypes.NewRegistry(discoveryOpts.FunctionSources, functionSources(sourceDependencies{
+		resolve:       resolve,
+		files:         watchedFiles.get,
+		swaggerDocs:   swaggerDocs,
+		swaggerFilter: cfg.SwaggerOperationFilter,
+		swaggerFetch:  swaggerFetch,
+		discoveryOpts: discoveryOpts,
+	})...)
+	if err != nil {
+		return errors.Wrap(err, "invalid function sources")
+	}
+
+	conflictPolicy, err := detector.ParseConflictPolicy(discoveryOpts.DetectionPolicy)
+	if err != nil {
+		return err
+	}
+	marker := detector.NewMarker(detectors, resolve, discoveryOpts.DetectionBackoff, discoveryOpts.DetectionTimeout, discoveryOpts.DetectionSchedule, conflictPolicy)
+
+	// cancels in-flight retries on shutdown
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-stop
+		cancel()
+	}()
 
 	var cache struct {
 		secrets   secretwatcher.SecretMap
@@ -92,10 +240,10 @@ func Run(opts bootstrap.Options, discoveryOpts options.DiscoveryOptions, stop <-
 
 	updateUpstream := func(us *v1.Upstream, secrets secretwatcher.SecretMap) {
 		log.Debugf("attempting update for %v", us.Name)
-		if err := updater.UpdateServiceInfo(store, us.Name, marker); err != nil {
+		if err := updater.UpdateServiceInfo(ctx, discoveryOpts.UpdateBackoff, store, us.Name, marker); err != nil {
 			errs <- errors.Wrapf(err, "updating upstream %v", us.Name)
 		}
-		if err := updater.UpdateFunctions(resolve, store, us.Name, secrets); err != nil {
+		if err := updater.UpdateFunctions(ctx, discoveryOpts.UpdateBackoff, sources, store, us.Name, secrets); err != nil {
 			errs <- errors.Wrapf(err, "updating upstream %v", us.Name)
 		}
 	}
@@ -119,6 +267,7 @@ func Run(opts bootstrap.Options, discoveryOpts options.DiscoveryOptions, stop <-
 			if !upstreamFound {
 				close(workQueues[usName])
 				delete(workQueues, usName)
+				metrics.QueueDepth.DeleteLabelValues(usName)
 			}
 		}
 
@@ -126,8 +275,11 @@ func Run(opts bootstrap.Options, discoveryOpts options.DiscoveryOptions, stop <-
 		// if new secrets come in, it will trigger a new update
 		go func(upstreams []*v1.Upstream) {
 			// update secret refs on secret watcher
-			refs := updater.GetSecretRefsToWatch(upstreams)
+			refs := append(updater.GetSecretRefsToWatch(sources, upstreams), marker.SecretRefs(upstreams)...)
 			secretWatcher.TrackSecrets(refs)
+			if fileWatcher != nil {
+				fileWatcher.TrackFiles(updater.GetFileRefsToWatch(sources, upstreams))
+			}
 		}(cache.upstreams)
 
 		for _, us := range cache.upstreams {
@@ -135,17 +287,19 @@ func Run(opts bootstrap.Options, discoveryOpts options.DiscoveryOptions, stop <-
 			if !ok {
 				workQueues[us.Name] = make(chan *workItem, maxThreadsPerUpstream)
 				// start worker thread for this upstream
-				go func(workQueues map[string]chan *workItem, usName string) {
+				go func(queue chan *workItem, usName string) {
 					log.Debugf("starting goroutine for %s", usName)
 					// allow upstream time to start up
 					time.Sleep(time.Second * 2)
-					for work := range workQueues[usName] {
+					for work := range queue {
+						metrics.QueueDepth.WithLabelValues(usName).Set(float64(len(queue)))
 						updateUpstream(work.upstream, work.secrets)
 					}
 					log.Debugf("exiting goroutine for %s", usName)
-				}(workQueues, us.Name)
+				}(workQueues[us.Name], us.Name)
 			}
 			workQueues[us.Name] <- &workItem{upstream: us, secrets: cache.secrets}
+			metrics.QueueDepth.WithLabelValues(us.Name).Set(float64(len(workQueues[us.Name])))
 		}
 	}
 
@@ -154,16 +308,34 @@ func Run(opts bootstrap.Options, discoveryOpts options.DiscoveryOptions, stop <-
 	for {
 		select {
 		case cache.secrets = <-secretWatcher.Secrets():
+			latest.set(cache.secrets)
+			checker.MarkSynced(health.ComponentSecrets)
 			update()
 		case cache.upstreams = <-upstreams:
+			checker.MarkSynced(health.ComponentStorage)
+			checker.MarkSynced(health.ComponentUpstreams)
+			update()
+			// only the watcher sends the complete list of upstreams
+			go func(upstreams []*v1.Upstream) {
+				sources.CollectGarbage(upstreams)
+				if err := marker.CollectGarbage(upstreams); err != nil {
+					errs <- errors.Wrap(err, "cleaning up after deleted upstreams")
+				}
+			}(cache.upstreams)
+		case files := <-fileUpdates:
+			watchedFiles.set(files)
 			update()
+		case err := <-fileErrs:
+			errs <- errors.Wrap(err, "watching files")
 		case <-ticker.C:
 			update()
 		case err := <-secretWatcher.Error():
+			checker.MarkFailed(health.ComponentSecrets, err)
 			errs <- err
 		case <-stop:
 			return nil
 		}
+		checker.Progress()
 	}
 }
 
@@ -251,6 +423,19 @@ func createResolver(opts bootstrap.Options) resolver.Resolver {
 	return resolver.NewResolver(kube)
 }
 
+func setupFileWatcher(fileStorage func() (dependencies.FileStorage, error), stop <-chan struct{}) (filewatcher.Interface, error) {
+	store, err := fileStorage()
+	if err != nil {
+		return nil, err
+	}
+	fileWatcher, err := filewatcher.NewFileWatcher(store)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to start file watcher")
+	}
+	go fileWatcher.Run(stop)
+	return fileWatcher, nil
+}
+
 func setupSecretWatcher(opts bootstrap.Options, stop <-chan struct{}) (secretwatcher.Interface, error) {
 	switch opts.SecretWatcherOptions.Type {
 	case bootstrap.WatcherTypeFile:
@@ -0,0 +1,152 @@
+package grpc
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"strconv"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+
+	"github.com/solo-io/gloo-api/pkg/api/types/v1"
+	"github.com/solo-io/gloo/pkg/log"
+	"github.com/solo-io/gloo/pkg/secretwatcher"
+)
+
+const (
+	// "true" to only connect with tls, "false" to only connect in plaintext.
+	// if unset, plaintext is tried first, then tls
+	AnnotationKeyTLS = "gloo.solo.io/grpc_tls"
+	// ref of a secret holding the ca certificate to verify the server with,
+	// and optionally a client certificate and key. implies tls
+	AnnotationKeyTLSSecretRef = "gloo.solo.io/grpc_tls_secret_ref"
+	// server name used for SNI and to verify the server certificate. implies tls
+	AnnotationKeyTLSServerName = "gloo.solo.io/grpc_tls_server_name"
+
+	// keys of the tls secret, matching kubernetes tls secrets
+	SecretKeyCA   = "ca.crt"
+	SecretKeyCert = "tls.crt"
+	SecretKeyKey  = "tls.key"
+
+	DefaultTimeout = 5 * time.Second
+)
+
+// TLSSecretRef returns the ref of the secret needed to connect to the upstream, if any
+func TLSSecretRef(us *v1.Upstream) string {
+	return annotation(us, AnnotationKeyTLSSecretRef)
+}
+
+// Reflect connects to the grpc server at addr and reflects its services.
+// each transport allowed for the upstream is tried in turn, bounded by timeout.
+// connections are always closed before returning
+func Reflect(ctx context.Context, us *v1.Upstream, addr string, secrets secretwatcher.SecretMap, timeout time.Duration) (*ReflectedServices, error) {
+	transports, err := transportsFor(us, secrets)
+	if err != nil {
+		return nil, err
+	}
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	var errs error
+	for _, transport := range transports {
+		reflected, err := reflectWith(ctx, addr, transport, timeout)
+		if err == nil {
+			return reflected, nil
+		}
+		errs = multierror.Append(errs, errors.Wrapf(err, "over %v", transport.name))
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, errs
+}
+
+type transport struct {
+	name string
+	opt  grpc.DialOption
+}
+
+func reflectWith(ctx context.Context, addr string, t transport, timeout time.Duration) (*ReflectedServices, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	cc, err := grpc.DialContext(ctx, addr, t.opt, grpc.WithBlock())
+	if err != nil {
+		return nil, errors.Wrapf(err, "dialing grpc on %v", addr)
+	}
+	defer func() {
+		if err := cc.Close(); err != nil {
+			log.Warnf("closing grpc connection to %v: %v", addr, err)
+		}
+	}()
+	return reflectServices(ctx, cc)
+}
+
+// the transports to try for the upstream, in order
+func transportsFor(us *v1.Upstream, secrets secretwatcher.SecretMap) ([]transport, error) {
+	plaintext := transport{name: "plaintext", opt: grpc.WithInsecure()}
+
+	mode := annotation(us, AnnotationKeyTLS)
+	explicitTLS := TLSSecretRef(us) != "" || annotation(us, AnnotationKeyTLSServerName) != ""
+	if mode != "" {
+		useTLS, err := strconv.ParseBool(mode)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid value for annotation %v", AnnotationKeyTLS)
+		}
+		if !useTLS {
+			if explicitTLS {
+				return nil, errors.Errorf("annotation %v disables tls, but tls is configured", AnnotationKeyTLS)
+			}
+			return []transport{plaintext}, nil
+		}
+		explicitTLS = true
+	}
+
+	cfg, err := tlsConfig(us, secrets)
+	if err != nil {
+		return nil, err
+	}
+	tlsTransport := transport{name: "tls", opt: grpc.WithTransportCredentials(credentials.NewTLS(cfg))}
+	if explicitTLS {
+		return []transport{tlsTransport}, nil
+	}
+	return []transport{plaintext, tlsTransport}, nil
+}
+
+func tlsConfig(us *v1.Upstream, secrets secretwatcher.SecretMap) (*tls.Config, error) {
+	cfg := &tls.Config{ServerName: annotation(us, AnnotationKeyTLSServerName)}
+	ref := TLSSecretRef(us)
+	if ref == "" {
+		return cfg, nil
+	}
+	secret, ok := secrets[ref]
+	if !ok {
+		return nil, errors.Errorf("tls secret %v not found", ref)
+	}
+	if ca := secret[SecretKeyCA]; ca != "" {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM([]byte(ca)) {
+			return nil, errors.Errorf("no valid certificates in %v of secret %v", SecretKeyCA, ref)
+		}
+		cfg.RootCAs = pool
+	}
+	cert, key := secret[SecretKeyCert], secret[SecretKeyKey]
+	if cert != "" || key != "" {
+		pair, err := tls.X509KeyPair([]byte(cert), []byte(key))
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid client certificate in secret %v", ref)
+		}
+		cfg.Certificates = []tls.Certificate{pair}
+	}
+	return cfg, nil
+}
+
+func annotation(us *v1.Upstream, key string) string {
+	if us.Metadata == nil {
+		return ""
+	}
+	return us.Metadata.Annotations[key]
+}
@@ -0,0 +1,51 @@
+package grpc
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/solo-io/gloo-api/pkg/api/types/v1"
+	"github.com/solo-io/gloo/pkg/secretwatcher"
+)
+
+func annotatedUpstream(annotations map[string]string) *v1.Upstream {
+	return &v1.Upstream{Name: "Test", Metadata: &v1.Metadata{Annotations: annotations}}
+}
+
+func transportNames(transports []transport) []string {
+	var names []string
+	for _, t := range transports {
+		names = append(names, t.name)
+	}
+	return names
+}
+
+var _ = Describe("grpc connections", func() {
+	Describe("transportsFor", func() {
+		It("tries plaintext, then tls, by default", func() {
+			transports, err := transportsFor(&v1.Upstream{}, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(transportNames(transports)).To(Equal([]string{"plaintext", "tls"}))
+		})
+		It("only uses tls when tls is configured", func() {
+			transports, err := transportsFor(annotatedUpstream(map[string]string{AnnotationKeyTLSServerName: "bookstore.example.com"}), nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(transportNames(transports)).To(Equal([]string{"tls"}))
+		})
+		It("only uses plaintext when tls is disabled", func() {
+			transports, err := transportsFor(annotatedUpstream(map[string]string{AnnotationKeyTLS: "false"}), nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(transportNames(transports)).To(Equal([]string{"plaintext"}))
+		})
+		It("errors when the tls secret is missing", func() {
+			_, err := transportsFor(annotatedUpstream(map[string]string{AnnotationKeyTLSSecretRef: "missing"}), secretwatcher.SecretMap{})
+			Expect(err).To(HaveOccurred())
+		})
+		It("errors when the secret holds an invalid ca", func() {
+			_, err := transportsFor(annotatedUpstream(map[string]string{AnnotationKeyTLSSecretRef: "tls"}), secretwatcher.SecretMap{
+				"tls": {SecretKeyCA: "not a certificate"},
+			})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
@@ -0,0 +1,129 @@
+package grpc
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+
+	"github.com/solo-io/gloo-api/pkg/api/types/v1"
+	grpcplugin "github.com/solo-io/gloo-plugins/grpc"
+	"github.com/solo-io/gloo-storage/dependencies"
+	"github.com/solo-io/gloo/pkg/log"
+)
+
+const (
+	// all descriptor files written by discovery start with this prefix
+	descriptorsFilePrefix = "grpc-discovery-"
+	// keeps the name before the : a valid kubernetes configmap name
+	maxUpstreamIDLength = 200
+)
+
+// descriptorsFileRef names the file after the upstream and the hash of the
+// descriptors, so upstreams with the same services never collide and the ref
+// changes whenever the descriptors do.
+// the : is a necessary separator for kube file storage
+// otherwise it's just ignored
+func descriptorsFileRef(upstreamName string, contents []byte) string {
+	return fmt.Sprintf("%v%v-%v:descriptors", descriptorsFilePrefix, upstreamID(upstreamName), shortHash(contents, 16))
+}
+
+// upstream names are unique, but not necessarily valid configmap names.
+// the hash of the name keeps sanitized names unique
+func upstreamID(upstreamName string) string {
+	sanitized := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-', r == '.':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r - 'A' + 'a'
+		}
+		return '-'
+	}, upstreamName)
+	if len(sanitized) > maxUpstreamIDLength {
+		sanitized = sanitized[:maxUpstreamIDLength]
+	}
+	return strings.Trim(sanitized, "-.") + "-" + shortHash([]byte(upstreamName), 8)
+}
+
+// upstreamIDForRef returns the id of the upstream a descriptors file was written
+// for, or false if the file was not written by discovery
+func upstreamIDForRef(ref string) (string, bool) {
+	if !strings.HasPrefix(ref, descriptorsFilePrefix) {
+		return "", false
+	}
+	name := strings.TrimPrefix(ref, descriptorsFilePrefix)
+	sep := strings.Index(name, ":")
+	if sep < 0 {
+		return "", false
+	}
+	name = name[:sep]
+	// strip the content hash
+	hashSep := strings.LastIndex(name, "-")
+	if hashSep < 0 {
+		return "", false
+	}
+	return name[:hashSep], true
+}
+
+func shortHash(b []byte, length int) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])[:length]
+}
+
+// writeDescriptorsFile creates the file, or updates it if it already exists
+func writeDescriptorsFile(files dependencies.FileStorage, ref string, contents []byte) error {
+	existing, err := files.Get(ref)
+	if err != nil {
+		// assume it does not exist yet
+		if _, err := files.Create(&dependencies.File{Ref: ref, Contents: contents}); err != nil {
+			return errors.Wrapf(err, "creating file %v", ref)
+		}
+		return nil
+	}
+	if bytes.Equal(existing.Contents, contents) {
+		return nil
+	}
+	existing.Contents = contents
+	if _, err := files.Update(existing); err != nil {
+		return errors.Wrapf(err, "updating file %v", ref)
+	}
+	return nil
+}
+
+// deleteDescriptorsFiles deletes the descriptor files written by discovery
+// for which keep returns false
+func deleteDescriptorsFiles(files dependencies.FileStorage, keep func(ref, upstreamID string) bool) error {
+	list, err := files.List()
+	if err != nil {
+		return errors.Wrap(err, "listing files")
+	}
+	var errs error
+	for _, file := range list {
+		id, ok := upstreamIDForRef(file.Ref)
+		if !ok || keep(file.Ref, id) {
+			continue
+		}
+		log.Debugf("deleting unused descriptors file %v", file.Ref)
+		if err := files.Delete(file.Ref); err != nil {
+			errs = multierror.Append(errs, errors.Wrapf(err, "deleting file %v", file.Ref))
+		}
+	}
+	return errs
+}
+
+// DescriptorsFileRefFor returns the descriptors file the upstream currently uses, if any
+func DescriptorsFileRefFor(us *v1.Upstream) string {
+	if us.ServiceInfo == nil || us.ServiceInfo.Type != grpcplugin.ServiceTypeGRPC {
+		return ""
+	}
+	props, err := grpcplugin.DecodeServiceProperties(us.ServiceInfo.Properties)
+	if err != nil {
+		return ""
+	}
+	return props.DescriptorsFileRef
+}
@@ -0,0 +1,25 @@
+package grpc
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("descriptor file refs", func() {
+	It("keys refs by upstream and content", func() {
+		ref := descriptorsFileRef("default-Bookstore_8080", []byte("descriptors"))
+		Expect(ref).To(MatchRegexp(`^grpc-discovery-default-bookstore-8080-[0-9a-f]{8}-[0-9a-f]{16}:descriptors$`))
+		Expect(descriptorsFileRef("default-Bookstore_8080", []byte("changed"))).NotTo(Equal(ref))
+
+		id, ok := upstreamIDForRef(ref)
+		Expect(ok).To(BeTrue())
+		Expect(id).To(Equal(upstreamID("default-Bookstore_8080")))
+	})
+	It("keeps upstreams with similar names apart", func() {
+		Expect(upstreamID("a_b")).NotTo(Equal(upstreamID("a-b")))
+	})
+	It("ignores files not written by discovery", func() {
+		_, ok := upstreamIDForRef("grpc-discovery:Bookstore.descriptors")
+		Expect(ok).To(BeFalse())
+	})
+})
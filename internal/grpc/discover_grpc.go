@@ -2,88 +2,77 @@ package grpc
 
 import (
 	"context"
-
-	"strings"
-
-	"fmt"
+	"time"
 
 	"github.com/gogo/protobuf/proto"
-	"github.com/golang/protobuf/protoc-gen-go/descriptor"
-	"github.com/jhump/protoreflect/desc"
-	"github.com/jhump/protoreflect/grpcreflect"
 	"github.com/pkg/errors"
 	"github.com/solo-io/gloo-api/pkg/api/types/v1"
 	"github.com/solo-io/gloo-function-discovery/internal/detector"
 	grpcplugin "github.com/solo-io/gloo-plugins/grpc"
 	"github.com/solo-io/gloo-storage/dependencies"
 	"github.com/solo-io/gloo/pkg/log"
-	"google.golang.org/grpc"
-	reflectpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"github.com/solo-io/gloo/pkg/secretwatcher"
 )
 
 type grpcDetector struct {
-	files dependencies.FileStorage
+	files   dependencies.FileStorage
+	secrets func() secretwatcher.SecretMap
+	timeout time.Duration
 }
 
-func NewGRPCDetector(files dependencies.FileStorage) detector.Interface {
+// NewGRPCDetector creates a detector that stores the reflected descriptors in files.
+// secrets provides the tls secrets referenced by upstreams, and may be nil.
+// timeout bounds each connection attempt
+func NewGRPCDetector(files dependencies.FileStorage, secrets func() secretwatcher.SecretMap, timeout time.Duration) detector.Interface {
 	return &grpcDetector{
-		files: files,
+		files:   files,
+		secrets: secrets,
+		timeout: timeout,
 	}
 }
 
+func (d *grpcDetector) SecretRefs(us *v1.Upstream) []string {
+	if ref := TLSSecretRef(us); ref != "" {
+		return []string{ref}
+	}
+	return nil
+}
+
 // if it detects the upstream is a known functional type, give us the
 // service info and annotations to mark it with
 func (d *grpcDetector) DetectFunctionalService(us *v1.Upstream, addr string) (*v1.ServiceInfo, map[string]string, error) {
 	log.Debugf("attempting to detect GRPC for %s", us.Name)
-	cc, err := grpc.Dial(addr, grpc.WithInsecure())
-	if err != nil {
-		return nil, nil, errors.Wrapf(err, "dialing grpc on %v", addr)
+	var secrets secretwatcher.SecretMap
+	if d.secrets != nil {
+		secrets = d.secrets()
 	}
-	refClient := grpcreflect.NewClient(context.Background(), reflectpb.NewServerReflectionClient(cc))
-
-	services, err := refClient.ListServices()
+	reflected, err := Reflect(context.Background(), us, addr, secrets, d.timeout)
 	if err != nil {
-		return nil, nil, errors.Wrapf(err, "listing services. are you sure %v implements reflection?", addr)
+		return nil, nil, errors.Wrapf(err, "are you sure %v implements reflection?", addr)
 	}
 	log.Printf("%v discovered as a gRPC service", addr)
-	var (
-		serviceNames []string
-	)
-	descriptors := &descriptor.FileDescriptorSet{}
-	for _, s := range services {
-		// ignore the reflection descriptor
-		if s == "grpc.reflection.v1alpha.ServerReflection" {
-			continue
-		}
-		files, err := getAllDescriptors(refClient, s)
-		if err != nil {
-			return nil, nil, errors.Wrapf(err, "getting descriptors for svc %s", s)
-		}
-		descriptors.File = append(descriptors.File, files...)
-
-		parts := strings.Split(s, ".")
-		serviceSuffix := parts[len(parts)-1]
-		serviceNames = append(serviceNames, serviceSuffix)
-	}
+	// fully qualified, services of different packages may share a name
+	serviceNames := reflected.Services
+	descriptors := reflected.Descriptors
 
 	b, err := proto.Marshal(descriptors)
 	if err != nil {
 		return nil, nil, errors.Wrap(err, "marshalling proto descriptors")
 	}
 
-	// the : is a necessary separator for kube file storage
-	// otherwise it's just ignored
-	fileRef := fmt.Sprintf("%v:%v.descriptors",
-		"grpc-discovery",
-		strings.Join(serviceNames, "."))
-
-	file := &dependencies.File{
-		Ref:      fileRef,
-		Contents: b,
+	fileRef := descriptorsFileRef(us.Name, b)
+	if err := writeDescriptorsFile(d.files, fileRef, b); err != nil {
+		return nil, nil, errors.Wrap(err, "writing file for discovered descriptors")
 	}
 
-	if _, err := d.files.Create(file); err != nil {
-		return nil, nil, errors.Wrap(err, "creating file for discovered descriptors")
+	// the file the upstream currently points to is kept until the upstream
+	// has been updated, it is collected on the next detection
+	currentRef := DescriptorsFileRefFor(us)
+	id := upstreamID(us.Name)
+	if err := deleteDescriptorsFiles(d.files, func(ref, upstreamID string) bool {
+		return upstreamID != id || ref == fileRef || ref == currentRef
+	}); err != nil {
+		log.Warnf("failed to clean up old descriptors for %v: %v", us.Name, err)
 	}
 
 	svcInfo := &v1.ServiceInfo{
@@ -97,20 +86,15 @@ func (d *grpcDetector) DetectFunctionalService(us *v1.Upstream, addr string) (*v
 	return svcInfo, nil, nil
 }
 
-func getAllDescriptors(refClient *grpcreflect.Client, s string) ([]*descriptor.FileDescriptorProto, error) {
-	root, err := refClient.FileContainingSymbol(s)
-	if err != nil {
-		return nil, errors.Wrapf(err, "getting file for symbol %s", s)
-	}
-	files := getDepTree(root)
-	return files, nil
-}
-
-func getDepTree(root *desc.FileDescriptor) []*descriptor.FileDescriptorProto {
-	var deps []*descriptor.FileDescriptorProto
-	for _, dep := range root.GetDependencies() {
-		deps = append(deps, getDepTree(dep)...)
+// CollectGarbage deletes the descriptor files of upstreams that no longer exist
+func (d *grpcDetector) CollectGarbage(upstreams []*v1.Upstream) error {
+	ids := make(map[string]bool)
+	refs := make(map[string]bool)
+	for _, us := range upstreams {
+		ids[upstreamID(us.Name)] = true
+		refs[DescriptorsFileRefFor(us)] = true
 	}
-	deps = append(deps, root.AsFileDescriptorProto())
-	return deps
+	return deleteDescriptorsFiles(d.files, func(ref, upstreamID string) bool {
+		return ids[upstreamID] || refs[ref]
+	})
 }
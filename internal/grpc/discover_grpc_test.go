@@ -4,44 +4,165 @@ import (
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
 	"fmt"
-
 	"io/ioutil"
-
+	"math/big"
+	"net"
 	"time"
 
 	"github.com/solo-io/gloo-api/pkg/api/types/v1"
+	. "github.com/solo-io/gloo-function-discovery/internal/detector"
 	. "github.com/solo-io/gloo-function-discovery/internal/grpc"
-	"github.com/solo-io/gloo-plugins/grpc"
+	grpcplugin "github.com/solo-io/gloo-plugins/grpc"
+	"github.com/solo-io/gloo-storage/dependencies"
 	"github.com/solo-io/gloo-storage/dependencies/file"
+	"github.com/solo-io/gloo-testing/e2e/containers/grpc-test-service/bookstore/protos"
+	"github.com/solo-io/gloo-testing/e2e/containers/grpc-test-service/server"
+	"github.com/solo-io/gloo/pkg/secretwatcher"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/reflection"
 )
 
 var _ = Describe("Discovergrpc", func() {
+	var (
+		files dependencies.FileStorage
+		addr  = fmt.Sprintf("localhost:%v", port)
+	)
+	BeforeEach(func() {
+		dir, err := ioutil.TempDir("", "")
+		Expect(err).To(BeNil())
+		files, err = file.NewFileStorage(dir, time.Millisecond)
+		Expect(err).To(BeNil())
+	})
+	detect := func(d Interface, us *v1.Upstream) grpcplugin.ServiceProperties {
+		svcInfo, annotations, err := d.DetectFunctionalService(us, addr)
+		Expect(err).To(BeNil())
+		Expect(annotations).To(BeNil())
+		Expect(svcInfo.Type).To(Equal(grpcplugin.ServiceTypeGRPC))
+		props, err := grpcplugin.DecodeServiceProperties(svcInfo.Properties)
+		Expect(err).To(BeNil())
+		return props
+	}
+	refs := func() []string {
+		list, err := files.List()
+		Expect(err).To(BeNil())
+		var refs []string
+		for _, f := range list {
+			refs = append(refs, f.Ref)
+		}
+		return refs
+	}
+
 	Describe("happy path", func() {
 		Context("upstream for a grpc server", func() {
 			It("returns service info for grpc", func() {
-				dir, err := ioutil.TempDir("", "")
-				Expect(err).To(BeNil())
-				files, err := file.NewFileStorage(dir, time.Millisecond)
-				Expect(err).To(BeNil())
-				detector := NewGRPCDetector(files)
-				addr := fmt.Sprintf("localhost:%v", port)
-				svcInfo, annotations, err := detector.DetectFunctionalService(&v1.Upstream{Name: "Test"}, addr)
-				Expect(err).To(BeNil())
-				Expect(annotations).To(BeNil())
-				fileRef := "grpc-discovery:Bookstore.descriptors"
-				Expect(svcInfo).To(Equal(&v1.ServiceInfo{
-					Type: grpc.ServiceTypeGRPC,
-					Properties: grpc.EncodeServiceProperties(grpc.ServiceProperties{
-						GRPCServiceNames:   []string{"Bookstore"},
-						DescriptorsFileRef: fileRef,
-					}),
-				}))
-				list, err := files.List()
-				Expect(err).To(BeNil())
-				Expect(list).To(HaveLen(1))
-				Expect(list[0].Ref).To(Equal(fileRef))
+				detector := NewGRPCDetector(files, nil, time.Second)
+				props := detect(detector, &v1.Upstream{Name: "Test"})
+				Expect(props.GRPCServiceNames).To(Equal([]string{"bookstore.Bookstore"}))
+				Expect(props.DescriptorsFileRef).To(HavePrefix("grpc-discovery-test-"))
+				Expect(refs()).To(Equal([]string{props.DescriptorsFileRef}))
 			})
 		})
 	})
+	Describe("descriptor files", func() {
+		It("writes a separate file for each upstream", func() {
+			detector := NewGRPCDetector(files, nil, time.Second)
+			first := detect(detector, &v1.Upstream{Name: "first"})
+			second := detect(detector, &v1.Upstream{Name: "second"})
+			Expect(first.DescriptorsFileRef).NotTo(Equal(second.DescriptorsFileRef))
+			Expect(refs()).To(ConsistOf(first.DescriptorsFileRef, second.DescriptorsFileRef))
+		})
+		It("reuses the file when detecting an upstream again", func() {
+			detector := NewGRPCDetector(files, nil, time.Second)
+			first := detect(detector, &v1.Upstream{Name: "Test"})
+			again := detect(detector, &v1.Upstream{Name: "Test"})
+			Expect(again.DescriptorsFileRef).To(Equal(first.DescriptorsFileRef))
+			Expect(refs()).To(HaveLen(1))
+		})
+		It("deletes the files of deleted upstreams", func() {
+			detector := NewGRPCDetector(files, nil, time.Second)
+			kept := detect(detector, &v1.Upstream{Name: "kept"})
+			detect(detector, &v1.Upstream{Name: "deleted"})
+			err := detector.(GarbageCollector).CollectGarbage([]*v1.Upstream{{Name: "kept"}})
+			Expect(err).To(BeNil())
+			Expect(refs()).To(Equal([]string{kept.DescriptorsFileRef}))
+		})
+	})
+	Describe("tls", func() {
+		var (
+			tlsServer *grpc.Server
+			tlsAddr   string
+			caPEM     string
+		)
+		BeforeEach(func() {
+			cert, ca := selfSignedCert()
+			caPEM = ca
+			lis, err := net.Listen("tcp", "localhost:0")
+			Expect(err).NotTo(HaveOccurred())
+			tlsAddr = lis.Addr().String()
+			tlsServer = grpc.NewServer(grpc.Creds(credentials.NewServerTLSFromCert(&cert)))
+			bookstore.RegisterBookstoreServer(tlsServer, server.NewServer())
+			reflection.Register(tlsServer)
+			go tlsServer.Serve(lis)
+		})
+		AfterEach(func() {
+			tlsServer.Stop()
+		})
+		It("detects a server that requires tls, verified with the ca from the secret", func() {
+			secrets := secretwatcher.SecretMap{"grpc-tls": {SecretKeyCA: caPEM}}
+			detector := NewGRPCDetector(files, func() secretwatcher.SecretMap { return secrets }, time.Second)
+			us := &v1.Upstream{Name: "secure", Metadata: &v1.Metadata{Annotations: map[string]string{
+				AnnotationKeyTLSSecretRef: "grpc-tls",
+			}}}
+			svcInfo, _, err := detector.DetectFunctionalService(us, tlsAddr)
+			Expect(err).NotTo(HaveOccurred())
+			props, err := grpcplugin.DecodeServiceProperties(svcInfo.Properties)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(props.GRPCServiceNames).To(Equal([]string{"bookstore.Bookstore"}))
+		})
+		It("fails when the server certificate cannot be verified", func() {
+			detector := NewGRPCDetector(files, nil, 200*time.Millisecond)
+			us := &v1.Upstream{Name: "secure", Metadata: &v1.Metadata{Annotations: map[string]string{
+				AnnotationKeyTLS: "true",
+			}}}
+			_, _, err := detector.DetectFunctionalService(us, tlsAddr)
+			Expect(err).To(HaveOccurred())
+		})
+	})
 })
+
+// selfSignedCert returns a certificate for localhost, and the certificate in pem
+// to verify it with
+func selfSignedCert() (tls.Certificate, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).NotTo(HaveOccurred())
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "localhost"},
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	Expect(err).NotTo(HaveOccurred())
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	Expect(err).NotTo(HaveOccurred())
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	Expect(err).NotTo(HaveOccurred())
+	return cert, string(certPEM)
+}
@@ -0,0 +1,51 @@
+package grpc
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+
+	"github.com/solo-io/gloo-function-discovery/internal/detector"
+)
+
+const DetectorName = "grpc"
+
+type Config struct {
+	Enabled bool `json:"-"`
+	// bounds each connection attempt, including reflection
+	Timeout detector.Duration `json:"timeout"`
+}
+
+type factory struct {
+	config Config
+}
+
+func NewFactory() detector.Factory {
+	return &factory{}
+}
+
+func (f *factory) Name() string {
+	return DetectorName
+}
+
+func (f *factory) Config() interface{} {
+	return &f.config
+}
+
+func (f *factory) AddFlags(flags *pflag.FlagSet) {
+	flags.BoolVar(&f.config.Enabled, "detect-grpc-upstreams", true, "enable automatic discovery of upstreams that are running gRPC Services and haeve reflection enabled.")
+	flags.DurationVar((*time.Duration)(&f.config.Timeout), "grpc-detection-timeout", DefaultTimeout, "timeout for each attempt to connect to an upstream and reflect its gRPC services")
+}
+
+func (f *factory) Enabled() bool {
+	return f.config.Enabled
+}
+
+func (f *factory) New(deps detector.Dependencies) (detector.Interface, error) {
+	files, err := deps.Files()
+	if err != nil {
+		return nil, errors.Wrap(err, "creating file storage client")
+	}
+	return NewGRPCDetector(files, deps.Secrets, time.Duration(f.config.Timeout)), nil
+}
@@ -0,0 +1,121 @@
+package grpc
+
+import (
+	"context"
+
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+	"github.com/hashicorp/go-multierror"
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/grpcreflect"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	reflectpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+
+	"github.com/solo-io/gloo/pkg/log"
+)
+
+const (
+	reflectionV1ServiceName      = "grpc.reflection.v1.ServerReflection"
+	reflectionV1AlphaServiceName = "grpc.reflection.v1alpha.ServerReflection"
+
+	reflectionV1Method = "/" + reflectionV1ServiceName + "/ServerReflectionInfo"
+)
+
+// ReflectedServices are the services a grpc server exposes through reflection
+type ReflectedServices struct {
+	// fully qualified names of the services, excluding reflection itself
+	Services []string
+	// the files defining the services, and their dependencies. each file
+	// appears once, after the files it depends on
+	Descriptors *descriptor.FileDescriptorSet
+}
+
+// reflectServices lists the services of the server on the other end of cc,
+// using the stable reflection api if the server supports it, else v1alpha
+func reflectServices(ctx context.Context, cc *grpc.ClientConn) (*ReflectedServices, error) {
+	reflected, err := reflectWithClient(ctx, &reflectionV1Client{cc: cc})
+	if err == nil {
+		return reflected, nil
+	}
+	log.Debugf("grpc reflection v1 failed, falling back to v1alpha: %v", err)
+	reflected, alphaErr := reflectWithClient(ctx, reflectpb.NewServerReflectionClient(cc))
+	if alphaErr != nil {
+		return nil, multierror.Append(errors.Wrap(err, "reflection v1"), errors.Wrap(alphaErr, "reflection v1alpha"))
+	}
+	return reflected, nil
+}
+
+func reflectWithClient(ctx context.Context, client reflectpb.ServerReflectionClient) (*ReflectedServices, error) {
+	refClient := grpcreflect.NewClient(ctx, client)
+	defer refClient.Reset()
+
+	services, err := refClient.ListServices()
+	if err != nil {
+		return nil, errors.Wrap(err, "listing services")
+	}
+	reflected := &ReflectedServices{
+		Descriptors: &descriptor.FileDescriptorSet{},
+	}
+	seen := make(map[string]bool)
+	for _, s := range services {
+		// ignore the reflection descriptors
+		if s == reflectionV1ServiceName || s == reflectionV1AlphaServiceName {
+			continue
+		}
+		root, err := refClient.FileContainingSymbol(s)
+		if err != nil {
+			return nil, errors.Wrapf(err, "getting file for symbol %s", s)
+		}
+		reflected.Services = append(reflected.Services, s)
+		reflected.Descriptors.File = appendDepTree(reflected.Descriptors.File, root, seen)
+	}
+	return reflected, nil
+}
+
+// appendDepTree appends the files root depends on, then root itself, skipping
+// files that were already seen. shared imports such as google/protobuf/*.proto
+// are only added once
+func appendDepTree(files []*descriptor.FileDescriptorProto, root *desc.FileDescriptor, seen map[string]bool) []*descriptor.FileDescriptorProto {
+	if seen[root.GetName()] {
+		return files
+	}
+	seen[root.GetName()] = true
+	for _, dep := range root.GetDependencies() {
+		files = appendDepTree(files, dep, seen)
+	}
+	return append(files, root.AsFileDescriptorProto())
+}
+
+// the v1 api has the same messages as v1alpha, only the service name differs
+type reflectionV1Client struct {
+	cc *grpc.ClientConn
+}
+
+func (c *reflectionV1Client) ServerReflectionInfo(ctx context.Context, opts ...grpc.CallOption) (reflectpb.ServerReflection_ServerReflectionInfoClient, error) {
+	streamDesc := &grpc.StreamDesc{
+		StreamName:    "ServerReflectionInfo",
+		ServerStreams: true,
+		ClientStreams: true,
+	}
+	stream, err := grpc.NewClientStream(ctx, streamDesc, c.cc, reflectionV1Method, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &reflectionV1Stream{ClientStream: stream}, nil
+}
+
+type reflectionV1Stream struct {
+	grpc.ClientStream
+}
+
+func (s *reflectionV1Stream) Send(m *reflectpb.ServerReflectionRequest) error {
+	return s.ClientStream.SendMsg(m)
+}
+
+func (s *reflectionV1Stream) Recv() (*reflectpb.ServerReflectionResponse, error) {
+	m := new(reflectpb.ServerReflectionResponse)
+	if err := s.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
@@ -0,0 +1,49 @@
+package grpc
+
+import (
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+	"github.com/jhump/protoreflect/desc"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func fileDescriptor(name string, deps ...*desc.FileDescriptor) *desc.FileDescriptor {
+	fdp := &descriptor.FileDescriptorProto{
+		Name:   proto.String(name),
+		Syntax: proto.String("proto3"),
+	}
+	for _, dep := range deps {
+		fdp.Dependency = append(fdp.Dependency, dep.GetName())
+	}
+	fd, err := desc.CreateFileDescriptor(fdp, deps...)
+	Expect(err).NotTo(HaveOccurred())
+	return fd
+}
+
+func fileNames(files []*descriptor.FileDescriptorProto) []string {
+	var names []string
+	for _, f := range files {
+		names = append(names, f.GetName())
+	}
+	return names
+}
+
+var _ = Describe("appendDepTree", func() {
+	It("adds each file once, after its dependencies", func() {
+		empty := fileDescriptor("google/protobuf/empty.proto")
+		common := fileDescriptor("common.proto", empty)
+		books := fileDescriptor("books.proto", empty, common)
+		shelves := fileDescriptor("shelves.proto", common, empty)
+
+		seen := make(map[string]bool)
+		files := appendDepTree(nil, books, seen)
+		files = appendDepTree(files, shelves, seen)
+		Expect(fileNames(files)).To(Equal([]string{
+			"google/protobuf/empty.proto",
+			"common.proto",
+			"books.proto",
+			"shelves.proto",
+		}))
+	})
+})
@@ -0,0 +1,41 @@
+package grpc_test
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/solo-io/gloo-api/pkg/api/types/v1"
+	. "github.com/solo-io/gloo-function-discovery/internal/grpc"
+)
+
+var _ = Describe("Reflect", func() {
+	addr := fmt.Sprintf("localhost:%v", port)
+	It("reflects the services of a plaintext server", func() {
+		reflected, err := Reflect(context.Background(), &v1.Upstream{}, addr, nil, time.Second)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reflected.Services).To(ContainElement("bookstore.Bookstore"))
+	})
+	It("returns each descriptor once, after its dependencies", func() {
+		reflected, err := Reflect(context.Background(), &v1.Upstream{}, addr, nil, time.Second)
+		Expect(err).NotTo(HaveOccurred())
+		seen := make(map[string]bool)
+		for _, file := range reflected.Descriptors.File {
+			Expect(seen).NotTo(HaveKey(file.GetName()))
+			for _, dep := range file.Dependency {
+				Expect(seen).To(HaveKey(dep))
+			}
+			seen[file.GetName()] = true
+		}
+	})
+	It("gives up on each transport after the timeout", func() {
+		us := &v1.Upstream{Metadata: &v1.Metadata{Annotations: map[string]string{AnnotationKeyTLS: "true"}}}
+		start := time.Now()
+		_, err := Reflect(context.Background(), us, addr, nil, 200*time.Millisecond)
+		Expect(err).To(HaveOccurred())
+		Expect(time.Since(start)).To(BeNumerically("<", 2*time.Second))
+	})
+})
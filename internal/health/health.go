@@ -0,0 +1,109 @@
+package health
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// components reported by the readiness check
+const (
+	ComponentStorage   = "storage"
+	ComponentUpstreams = "upstream_watcher"
+	ComponentSecrets   = "secret_watcher"
+)
+
+// Checker tracks whether the components discovery depends on have synced,
+// and whether the event loop is still making progress
+type Checker struct {
+	progressTimeout time.Duration
+
+	m            sync.RWMutex
+	components   map[string]error
+	lastProgress time.Time
+}
+
+// NewChecker returns a checker that is ready once every given component has been
+// marked synced. the event loop is considered stuck if it makes no progress for progressTimeout
+func NewChecker(progressTimeout time.Duration, components ...string) *Checker {
+	c := &Checker{
+		progressTimeout: progressTimeout,
+		components:      make(map[string]error),
+		lastProgress:    time.Now(),
+	}
+	for _, component := range components {
+		c.components[component] = fmt.Errorf("not synced yet")
+	}
+	return c
+}
+
+func (c *Checker) MarkSynced(component string) {
+	c.m.Lock()
+	c.components[component] = nil
+	c.m.Unlock()
+}
+
+func (c *Checker) MarkFailed(component string, err error) {
+	c.m.Lock()
+	c.components[component] = err
+	c.m.Unlock()
+}
+
+// Progress is called by the event loop every time it handles an event
+func (c *Checker) Progress() {
+	c.m.Lock()
+	c.lastProgress = time.Now()
+	c.m.Unlock()
+}
+
+// Healthy returns an error if the event loop has stopped making progress
+func (c *Checker) Healthy() error {
+	c.m.RLock()
+	defer c.m.RUnlock()
+	if since := time.Since(c.lastProgress); since > c.progressTimeout {
+		return fmt.Errorf("event loop has not made progress in %v", since)
+	}
+	return nil
+}
+
+// Ready returns an error if discovery is unhealthy or any component has not synced
+func (c *Checker) Ready() error {
+	if err := c.Healthy(); err != nil {
+		return err
+	}
+	c.m.RLock()
+	defer c.m.RUnlock()
+	var names []string
+	for name := range c.components {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := c.components[name]; err != nil {
+			return fmt.Errorf("%v: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// HealthzHandler serves the liveness check
+func (c *Checker) HealthzHandler() http.Handler {
+	return checkHandler(c.Healthy)
+}
+
+// ReadyzHandler serves the readiness check
+func (c *Checker) ReadyzHandler() http.Handler {
+	return checkHandler(c.Ready)
+}
+
+func checkHandler(check func() error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := check(); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	})
+}
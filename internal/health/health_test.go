@@ -0,0 +1,44 @@
+package health_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+
+	. "github.com/solo-io/gloo-function-discovery/internal/health"
+)
+
+func statusCode(h http.Handler) int {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	return w.Code
+}
+
+var _ = Describe("Checker", func() {
+	It("is ready once every component has synced", func() {
+		c := NewChecker(time.Minute, ComponentStorage, ComponentSecrets)
+		Expect(statusCode(c.HealthzHandler())).To(Equal(http.StatusOK))
+		Expect(statusCode(c.ReadyzHandler())).To(Equal(http.StatusServiceUnavailable))
+
+		c.MarkSynced(ComponentStorage)
+		Expect(c.Ready()).To(MatchError(ContainSubstring(ComponentSecrets)))
+		c.MarkSynced(ComponentSecrets)
+		Expect(statusCode(c.ReadyzHandler())).To(Equal(http.StatusOK))
+
+		c.MarkFailed(ComponentSecrets, errors.New("watch failed"))
+		Expect(c.Ready()).To(MatchError(ContainSubstring("watch failed")))
+	})
+	It("is unhealthy when the event loop stops making progress", func() {
+		c := NewChecker(10 * time.Millisecond)
+		Expect(c.Healthy()).NotTo(HaveOccurred())
+		time.Sleep(20 * time.Millisecond)
+		Expect(statusCode(c.HealthzHandler())).To(Equal(http.StatusServiceUnavailable))
+		Expect(c.Ready()).To(HaveOccurred())
+		c.Progress()
+		Expect(statusCode(c.HealthzHandler())).To(Equal(http.StatusOK))
+	})
+})
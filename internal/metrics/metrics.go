@@ -0,0 +1,86 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	namespace = "gloo"
+	subsystem = "function_discovery"
+
+	// kinds of upstream writes
+	WriteServiceInfo = "service_info"
+	WriteFunctions   = "functions"
+)
+
+var (
+	DetectionAttempts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "detection_attempts_total",
+		Help:      "Number of attempts to detect the service type of an upstream, by detector.",
+	}, []string{"detector"})
+
+	DetectionSuccesses = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "detection_successes_total",
+		Help:      "Number of upstreams whose service type was detected, by detector.",
+	}, []string{"detector"})
+
+	FunctionFetchDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "function_fetch_duration_seconds",
+		Help:      "Time taken to retrieve the function list for an upstream, by function type and result.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"function_type", "result"})
+
+	UpstreamWrites = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "upstream_writes_total",
+		Help:      "Number of upstreams written to storage, by the kind of discovered data written.",
+	}, []string{"kind"})
+
+	UpstreamWriteConflicts = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "upstream_write_conflicts_total",
+		Help:      "Number of upstream writes rejected because the upstream was modified concurrently.",
+	})
+
+	QueueDepth = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "queue_depth",
+		Help:      "Number of pending updates in the work queue of each upstream.",
+	}, []string{"upstream"})
+)
+
+func init() {
+	prometheus.MustRegister(
+		DetectionAttempts,
+		DetectionSuccesses,
+		FunctionFetchDuration,
+		UpstreamWrites,
+		UpstreamWriteConflicts,
+		QueueDepth,
+	)
+}
+
+// Handler serves the metrics in the prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// Result is the value of the result label for an operation's error
+func Result(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "success"
+}
@@ -0,0 +1,28 @@
+package metrics_test
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/solo-io/gloo-function-discovery/internal/metrics"
+)
+
+var _ = Describe("Metrics", func() {
+	It("serves the discovery metrics", func() {
+		DetectionAttempts.WithLabelValues("swagger").Inc()
+		QueueDepth.WithLabelValues("my-upstream").Set(3)
+
+		srv := httptest.NewServer(Handler())
+		defer srv.Close()
+		res, err := srv.Client().Get(srv.URL)
+		Expect(err).NotTo(HaveOccurred())
+		defer res.Body.Close()
+		b, err := ioutil.ReadAll(res.Body)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(b)).To(ContainSubstring(`gloo_function_discovery_detection_attempts_total{detector="swagger"} 1`))
+		Expect(string(b)).To(ContainSubstring(`gloo_function_discovery_queue_depth{upstream="my-upstream"} 3`))
+	})
+})
@@ -1,6 +1,7 @@
 package nats
 
 import (
+	"github.com/hashicorp/go-multierror"
 	"github.com/nats-io/go-nats-streaming"
 	"github.com/pkg/errors"
 	"github.com/solo-io/gloo-api/pkg/api/types/v1"
@@ -10,20 +11,32 @@ import (
 )
 
 const (
-	// TODO: add more cluster ids, or extend with config options
-	defaultClusterID = "test-cluster"
+	// AnnotationKeyClusterID overrides the cluster ids to try for an upstream
+	AnnotationKeyClusterID = "gloo.solo.io/nats_cluster_id"
+
+	DefaultClusterID = "test-cluster"
+
+	clientID = "gloo-function-discovery"
 )
 
 type natsDetector struct {
-	clusterID string
+	clusterIDs []string
 }
 
-func NewNatsDetector(clusterID string) detector.Interface {
-	if clusterID == "" {
-		clusterID = defaultClusterID
+// NewNatsDetector creates a detector that tries to connect with each of the
+// cluster ids, in order. the default cluster id is used if none are given
+func NewNatsDetector(clusterIDs ...string) detector.Interface {
+	var ids []string
+	for _, id := range clusterIDs {
+		if id != "" {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		ids = []string{DefaultClusterID}
 	}
 	return &natsDetector{
-		clusterID: defaultClusterID,
+		clusterIDs: ids,
 	}
 }
 
@@ -31,20 +44,42 @@ func NewNatsDetector(clusterID string) detector.Interface {
 // service info and annotations to mark it with
 func (d *natsDetector) DetectFunctionalService(us *v1.Upstream, addr string) (*v1.ServiceInfo, map[string]string, error) {
 	log.Debugf("attempting to detect NATS for %s", us.Name)
-	// try to connect to the addr as though it's a NATS cluster
-	c, err := stan.Connect(d.clusterID, "gloo-function-discovery", stan.NatsURL("nats://"+addr))
-	if err != nil {
-		return nil, nil, errors.Wrap(err, "failed to connect to nats-streaming cluster")
-	}
-	defer c.Close()
-
-	log.Printf("nats upstream detected: %v", addr)
-	svcInfo := &v1.ServiceInfo{
-		Type: natsstreaming.ServiceTypeNatsStreaming,
-		Properties: natsstreaming.EncodeServiceProperties(natsstreaming.ServiceProperties{
-			ClusterID: d.clusterID,
-		}),
+	var errs error
+	for _, clusterID := range d.clusterIDsFor(us) {
+		// try to connect to the addr as though it's a NATS cluster
+		c, err := stan.Connect(clusterID, clientID, stan.NatsURL("nats://"+addr))
+		if err != nil {
+			errs = multierror.Append(errs, errors.Wrapf(err, "cluster id %v", clusterID))
+			continue
+		}
+		c.Close()
+
+		log.Printf("nats upstream detected: %v (cluster id %v)", addr, clusterID)
+		svcInfo := &v1.ServiceInfo{
+			Type: natsstreaming.ServiceTypeNatsStreaming,
+			Properties: natsstreaming.EncodeServiceProperties(natsstreaming.ServiceProperties{
+				ClusterID: clusterID,
+			}),
+		}
+		return svcInfo, nil, nil
 	}
+	return nil, nil, errors.Wrap(errs, "failed to connect to nats-streaming cluster")
+}
 
-	return svcInfo, nil, nil
+// the annotation on the upstream is tried first
+func (d *natsDetector) clusterIDsFor(us *v1.Upstream) []string {
+	if us.Metadata == nil {
+		return d.clusterIDs
+	}
+	override, ok := us.Metadata.Annotations[AnnotationKeyClusterID]
+	if !ok || override == "" {
+		return d.clusterIDs
+	}
+	ids := []string{override}
+	for _, id := range d.clusterIDs {
+		if id != override {
+			ids = append(ids, id)
+		}
+	}
+	return ids
 }
@@ -28,6 +28,32 @@ var _ = Describe("DiscoverNats", func() {
 					}),
 				}))
 			})
+			It("tries each cluster id until one succeeds", func() {
+				err = natsStreamingInstance.Run()
+				Expect(err).NotTo(HaveOccurred())
+				detector := NewNatsDetector("wrong-cluster", natsStreamingInstance.ClusterId())
+				svcInfo, _, err := detector.DetectFunctionalService(&v1.Upstream{Name: "Test"}, fmt.Sprintf("localhost:%v", natsStreamingInstance.NatsPort()))
+				Expect(err).To(BeNil())
+				Expect(svcInfo.Properties).To(Equal(natsstreaming.EncodeServiceProperties(natsstreaming.ServiceProperties{
+					ClusterID: natsStreamingInstance.ClusterId(),
+				})))
+			})
+			It("uses the cluster id from the upstream annotation", func() {
+				err = natsStreamingInstance.Run()
+				Expect(err).NotTo(HaveOccurred())
+				detector := NewNatsDetector("wrong-cluster")
+				us := &v1.Upstream{
+					Name: "Test",
+					Metadata: &v1.Metadata{Annotations: map[string]string{
+						AnnotationKeyClusterID: natsStreamingInstance.ClusterId(),
+					}},
+				}
+				svcInfo, _, err := detector.DetectFunctionalService(us, fmt.Sprintf("localhost:%v", natsStreamingInstance.NatsPort()))
+				Expect(err).To(BeNil())
+				Expect(svcInfo.Properties).To(Equal(natsstreaming.EncodeServiceProperties(natsstreaming.ServiceProperties{
+					ClusterID: natsStreamingInstance.ClusterId(),
+				})))
+			})
 		})
 	})
 })
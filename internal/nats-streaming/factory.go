@@ -0,0 +1,44 @@
+package nats
+
+import (
+	"github.com/spf13/pflag"
+
+	"github.com/solo-io/gloo-function-discovery/internal/detector"
+)
+
+const DetectorName = "nats"
+
+type Config struct {
+	Enabled    bool     `json:"-"`
+	ClusterIDs []string `json:"cluster_ids"`
+}
+
+type factory struct {
+	config Config
+}
+
+func NewFactory() detector.Factory {
+	return &factory{}
+}
+
+func (f *factory) Name() string {
+	return DetectorName
+}
+
+func (f *factory) Config() interface{} {
+	return &f.config
+}
+
+func (f *factory) AddFlags(flags *pflag.FlagSet) {
+	flags.BoolVar(&f.config.Enabled, "detect-nats-upstreams", true, "enable automatic discovery of upstreams that are running NATS by connecting to the configured cluster ids.")
+	flags.StringSliceVar(&f.config.ClusterIDs, "nats-cluster-ids", []string{DefaultClusterID}, "cluster ids to try when connecting to upstreams to detect NATS Streaming. "+
+		"an upstream can override these with the "+AnnotationKeyClusterID+" annotation")
+}
+
+func (f *factory) Enabled() bool {
+	return f.config.Enabled
+}
+
+func (f *factory) New(_ detector.Dependencies) (detector.Interface, error) {
+	return NewNatsDetector(f.config.ClusterIDs...), nil
+}
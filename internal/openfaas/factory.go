@@ -0,0 +1,41 @@
+package openfaas
+
+import (
+	"github.com/spf13/pflag"
+
+	"github.com/solo-io/gloo-function-discovery/internal/detector"
+)
+
+const DetectorName = "faas"
+
+type Config struct {
+	Enabled bool `json:"-"`
+}
+
+type factory struct {
+	config Config
+}
+
+func NewFactory() detector.Factory {
+	return &factory{}
+}
+
+func (f *factory) Name() string {
+	return DetectorName
+}
+
+func (f *factory) Config() interface{} {
+	return &f.config
+}
+
+func (f *factory) AddFlags(flags *pflag.FlagSet) {
+	flags.BoolVar(&f.config.Enabled, "detect-faas-upstreams", true, "enable automatic discovery open faas upstreams.")
+}
+
+func (f *factory) Enabled() bool {
+	return f.config.Enabled
+}
+
+func (f *factory) New(_ detector.Dependencies) (detector.Interface, error) {
+	return NewFaasDetector(), nil
+}
@@ -1,12 +1,63 @@
 package options
 
+import (
+	"io/ioutil"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+
+	"github.com/solo-io/gloo-function-discovery/internal/detector"
+	"github.com/solo-io/gloo-function-discovery/internal/updater/swagger"
+	"github.com/solo-io/gloo-function-discovery/pkg/backoff"
+)
+
 type DiscoveryOptions struct {
-	AutoDiscoverSwagger bool
-	SwaggerUrisToTry    []string
+	// optional path to a yaml ConfigFile
+	ConfigFile string
+
+	// retry policy for each detector trying to detect an upstream's service type
+	DetectionBackoff backoff.Policy
+	// bounds the retries of each detector, 0 leaves them to DetectionBackoff
+	DetectionTimeout time.Duration
+	// when upstreams are detected again, after success or failure
+	DetectionSchedule detector.Schedule
+	// how to choose between detectors that recognize the same upstream, one of
+	// the detector.ConflictPolicy values
+	DetectionPolicy string
+	// retry policy for writing discovered service info and functions to storage
+	UpdateBackoff backoff.Policy
 
-	AutoDiscoverNATS bool
-	AutoDiscoverFAAS bool
-	ClusterIDsToTry  []string
+	// names of the function sources to discover functions with
+	FunctionSources []string
+	// port of the monitoring endpoint of nats-streaming upstreams, used to discover channels
+	NatsMonitoringPort int
+	// bounds each connection to a grpc upstream when discovering its methods
+	GRPCReflectionTimeout time.Duration
+	// swagger docs are reused for this long before checking if they changed
+	SwaggerCacheTTL time.Duration
+}
+
+// ConfigFile holds the discovery settings that are not practical to set by flag
+type ConfigFile struct {
+	// when set, only the listed detectors are run, in the listed order
+	Detectors []detector.Section `json:"detectors"`
+	// selects the operations of swagger docs that become functions, for upstreams
+	// without the swagger operation filter annotation
+	SwaggerOperationFilter *swagger.OperationFilter `json:"swagger_operation_filter"`
+}
 
-	AutoDiscoverGRPC bool
+func LoadConfigFile(path string) (*ConfigFile, error) {
+	if path == "" {
+		return &ConfigFile{}, nil
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading config file %v", path)
+	}
+	var cfg ConfigFile
+	if err := yaml.Unmarshal(b, &cfg); err != nil {
+		return nil, errors.Wrapf(err, "parsing config file %v", path)
+	}
+	return &cfg, nil
 }
@@ -1,7 +1,7 @@
 package swagger
 
 import (
-	"net/http"
+	"strconv"
 
 	"github.com/pkg/errors"
 
@@ -11,6 +11,7 @@ import (
 	"github.com/solo-io/gloo-function-discovery/internal/updater/swagger"
 	"github.com/solo-io/gloo-plugins/rest"
 	"github.com/solo-io/gloo/pkg/log"
+	"github.com/solo-io/gloo/pkg/secretwatcher"
 )
 
 var commonSwaggerURIs = []string{
@@ -21,34 +22,66 @@ var commonSwaggerURIs = []string{
 	"/v2/swagger",
 }
 
+var defaultSchemes = []string{"http", "https"}
+
+// ProbeOptions configure the requests the detector probes upstreams with
+type ProbeOptions struct {
+	// schemes to try, in order. defaults to http, then https
+	Schemes []string
+	// sent with every request
+	Headers map[string]string
+	// skip verifying the certificates of https endpoints
+	InsecureSkipVerify bool
+	// provides the secrets referenced by the auth annotation. may be nil
+	Secrets func() secretwatcher.SecretMap
+	// docs found while probing are cached for function discovery. may be nil
+	Docs *swagger.DocCache
+}
+
 type swaggerDetector struct {
 	swaggerUrisToTry []string
+	probe            ProbeOptions
 }
 
-func NewSwaggerDetector(swaggerUrisToTry []string) detector.Interface {
+func NewSwaggerDetector(swaggerUrisToTry []string, probe ProbeOptions) detector.Interface {
+	if len(probe.Schemes) == 0 {
+		probe.Schemes = defaultSchemes
+	}
 	return &swaggerDetector{
 		swaggerUrisToTry: append(commonSwaggerURIs, swaggerUrisToTry...),
+		probe:            probe,
 	}
 }
 
+func (d *swaggerDetector) SecretRefs(us *v1.Upstream) []string {
+	if ref := swagger.AuthSecretRef(us); ref != "" {
+		return []string{ref}
+	}
+	return nil
+}
+
 func (d *swaggerDetector) DetectFunctionalService(us *v1.Upstream, addr string) (*v1.ServiceInfo, map[string]string, error) {
 	var errs error
 	log.Debugf("attempting to detect swagger for %s", us.Name)
-	for _, uri := range d.swaggerUrisToTry {
-		url := "http://" + addr + uri
-		req, err := http.NewRequest("GET", url, nil)
-		if err != nil {
-			return nil, nil, errors.Wrap(err, "invalid url for request")
-		}
-		req.Header.Set("X-Gloo-Discovery", "Swagger-Discovery")
-		res, err := http.Get(url)
-		if err != nil {
-			errs = multierror.Append(errs, errors.Wrapf(err, "could not perform HTTP GET on resolved addr: %v", addr))
-			continue
-		}
-		// might have found a swagger service
-		if res.StatusCode == 200 {
-			if _, err := swagger.RetrieveSwaggerDocFromUrl(url); err != nil {
+
+	var secrets secretwatcher.SecretMap
+	if d.probe.Secrets != nil {
+		secrets = d.probe.Secrets()
+	}
+	auth, err := swagger.AuthFromSecret(us, secrets)
+	if err != nil {
+		return nil, nil, err
+	}
+	opts := swagger.FetchOptions{
+		Headers:            discoveryHeaders(d.probe.Headers),
+		Auth:               auth,
+		InsecureSkipVerify: d.probe.InsecureSkipVerify,
+	}
+
+	for _, scheme := range d.probe.Schemes {
+		for _, uri := range d.swaggerUrisToTry {
+			url := scheme + "://" + addr + uri
+			if _, _, err := d.probe.Docs.Get(url, opts); err != nil {
 				errs = multierror.Append(errs, err)
 				continue
 			}
@@ -58,9 +91,11 @@ func (d *swaggerDetector) DetectFunctionalService(us *v1.Upstream, addr string)
 				Type: rest.ServiceTypeREST,
 			}
 			annotations := map[string]string{swagger.AnnotationKeySwaggerURL: url}
+			// the function source fetches the doc the same way
+			if scheme == "https" && d.probe.InsecureSkipVerify {
+				annotations[swagger.AnnotationKeySwaggerInsecureSkipVerify] = strconv.FormatBool(true)
+			}
 			return svcInfo, annotations, nil
-		} else {
-			errs = multierror.Append(errs, errors.Errorf("path: %v response code: %v headers: %v", uri, res.Status, res.Header))
 		}
 	}
 	log.Printf("failed to detect swagger for %s: %v", us.Name, errs.Error())
@@ -68,3 +103,12 @@ func (d *swaggerDetector) DetectFunctionalService(us *v1.Upstream, addr string)
 	return nil, nil, errors.Wrapf(errs, "service at %s does not implement swagger at a known endpoint, "+
 		"or was unreachable", addr)
 }
+
+// identifies discovery's requests to the server, along with the configured headers
+func discoveryHeaders(configured map[string]string) map[string]string {
+	headers := map[string]string{"X-Gloo-Discovery": "Swagger-Discovery"}
+	for name, value := range configured {
+		headers[name] = value
+	}
+	return headers
+}
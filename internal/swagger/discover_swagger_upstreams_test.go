@@ -36,7 +36,7 @@ var _ = Describe("DiscoverSwaggerUpstreams", func() {
 			})
 			It("returns annotations with swagger doc url and service info for REST", func() {
 				addr := strings.TrimPrefix(srv.URL, "http://")
-				d := NewSwaggerDetector(nil)
+				d := NewSwaggerDetector(nil, ProbeOptions{})
 				svc, annotations, err := d.DetectFunctionalService(&v1.Upstream{Name: "Test"}, addr)
 				Expect(err).To(BeNil())
 				Expect(annotations).To(Equal(map[string]string{
@@ -0,0 +1,107 @@
+package swagger
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+
+	"github.com/solo-io/gloo-function-discovery/internal/detector"
+	"github.com/solo-io/gloo-function-discovery/internal/updater/swagger"
+)
+
+const DetectorName = "swagger"
+
+type Config struct {
+	Enabled bool `json:"-"`
+	// paths to query for swagger docs, in addition to the common ones
+	SwaggerUrisToTry []string `json:"swagger_uris"`
+	// schemes to probe, in order
+	Schemes []string `json:"schemes"`
+	// headers sent when probing, in addition to the ones set by flag
+	Headers     map[string]string `json:"headers"`
+	HeaderFlags []string          `json:"-"`
+	// skip verifying the certificates of https endpoints
+	InsecureSkipVerify bool `json:"insecure_skip_verify"`
+}
+
+type factory struct {
+	config Config
+	docs   *swagger.DocCache
+}
+
+// NewFactory creates the swagger detector factory. docs is the cache detected docs
+// are shared through with function discovery, and may be nil
+func NewFactory(docs *swagger.DocCache) detector.Factory {
+	return &factory{docs: docs}
+}
+
+func (f *factory) Name() string {
+	return DetectorName
+}
+
+func (f *factory) Config() interface{} {
+	return &f.config
+}
+
+func (f *factory) AddFlags(flags *pflag.FlagSet) {
+	flags.BoolVar(&f.config.Enabled, "detect-swagger-upstreams", true, "enable automatic discovery of upstreams that implement Swagger by querying for common Swagger Doc endpoints.")
+	flags.StringSliceVar(&f.config.SwaggerUrisToTry, "swagger-uris", []string{}, "paths function discovery should try to use to discover swagger services. function discovery will query http://<upstream>/<uri> for the swagger.json document. "+
+		"if found, REST functions will be discovered for this upstream.")
+	flags.StringSliceVar(&f.config.Schemes, "swagger-schemes", defaultSchemes, "schemes to try, in order, when querying upstreams for swagger docs")
+	flags.StringSliceVar(&f.config.HeaderFlags, "swagger-headers", []string{}, "headers to send when querying upstreams for swagger docs, as Name=Value. "+
+		"credentials can be provided per upstream in the secret referenced by the "+swagger.AnnotationKeySwaggerAuthSecretRef+" annotation")
+	flags.BoolVar(&f.config.InsecureSkipVerify, "swagger-insecure-skip-verify", false, "skip verifying the certificates of upstreams serving swagger docs over https")
+}
+
+func (f *factory) Enabled() bool {
+	return f.config.Enabled
+}
+
+func (f *factory) New(deps detector.Dependencies) (detector.Interface, error) {
+	headers, err := f.headers()
+	if err != nil {
+		return nil, err
+	}
+	return NewSwaggerDetector(f.config.SwaggerUrisToTry, ProbeOptions{
+		Schemes:            f.config.Schemes,
+		Headers:            headers,
+		InsecureSkipVerify: f.config.InsecureSkipVerify,
+		Secrets:            deps.Secrets,
+		Docs:               f.docs,
+	}), nil
+}
+
+// the headers set by flag and in the config file, which take precedence
+func (f *factory) headers() (map[string]string, error) {
+	headers := make(map[string]string)
+	for _, header := range f.config.HeaderFlags {
+		parts := strings.SplitN(header, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, errors.Errorf("invalid header %q, must be Name=Value", header)
+		}
+		headers[parts[0]] = parts[1]
+	}
+	for name, value := range f.config.Headers {
+		headers[name] = value
+	}
+	return headers, nil
+}
+
+// FetchOptionsFrom returns the headers and tls settings configured for the swagger
+// detector in the registry, so that function discovery fetches the detected docs the
+// same way. the config file must have been applied by creating the detectors first
+func FetchOptionsFrom(registry *detector.Registry) (swagger.FetchOptions, error) {
+	f, ok := registry.Factory(DetectorName).(*factory)
+	if !ok {
+		return swagger.FetchOptions{}, nil
+	}
+	headers, err := f.headers()
+	if err != nil {
+		return swagger.FetchOptions{}, err
+	}
+	return swagger.FetchOptions{
+		Headers:            discoveryHeaders(headers),
+		InsecureSkipVerify: f.config.InsecureSkipVerify,
+	}, nil
+}
@@ -0,0 +1,96 @@
+package swagger_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/solo-io/gloo-api/pkg/api/types/v1"
+	"github.com/solo-io/gloo-function-discovery/internal/detector"
+	. "github.com/solo-io/gloo-function-discovery/internal/swagger"
+	"github.com/solo-io/gloo-function-discovery/internal/updater/swagger"
+	"github.com/solo-io/gloo/pkg/secretwatcher"
+	"github.com/spf13/pflag"
+)
+
+var _ = Describe("probing swagger endpoints", func() {
+	// serves the doc only to requests with the expected header value
+	protected := func(header, value string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/swagger.json" {
+				http.NotFound(w, r)
+				return
+			}
+			if r.Header.Get(header) != value {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			fmt.Fprint(w, swaggerDoc)
+		})
+	}
+	upstream := func(annotations map[string]string) *v1.Upstream {
+		return &v1.Upstream{Name: "Test", Metadata: &v1.Metadata{Annotations: annotations}}
+	}
+
+	It("sends the configured headers", func() {
+		srv := httptest.NewServer(protected("X-Tenant", "gloo"))
+		defer srv.Close()
+		d := NewSwaggerDetector(nil, ProbeOptions{Headers: map[string]string{"X-Tenant": "gloo"}})
+		_, annotations, err := d.DetectFunctionalService(upstream(nil), strings.TrimPrefix(srv.URL, "http://"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(annotations[swagger.AnnotationKeySwaggerURL]).To(Equal(srv.URL + "/swagger.json"))
+	})
+	It("authenticates with the credentials in the secret", func() {
+		srv := httptest.NewServer(protected("Authorization", "Bearer s3cret"))
+		defer srv.Close()
+		secrets := secretwatcher.SecretMap{"swagger-auth": {swagger.SecretKeyToken: "s3cret"}}
+		d := NewSwaggerDetector(nil, ProbeOptions{Secrets: func() secretwatcher.SecretMap { return secrets }})
+		us := upstream(map[string]string{swagger.AnnotationKeySwaggerAuthSecretRef: "swagger-auth"})
+		Expect(d.(detector.SecretConsumer).SecretRefs(us)).To(Equal([]string{"swagger-auth"}))
+
+		_, _, err := d.DetectFunctionalService(us, strings.TrimPrefix(srv.URL, "http://"))
+		Expect(err).NotTo(HaveOccurred())
+
+		_, _, err = d.DetectFunctionalService(upstream(nil), strings.TrimPrefix(srv.URL, "http://"))
+		Expect(err).To(HaveOccurred())
+	})
+	It("detects swagger served over https", func() {
+		srv := httptest.NewTLSServer(protected("X-Gloo-Discovery", "Swagger-Discovery"))
+		defer srv.Close()
+		d := NewSwaggerDetector(nil, ProbeOptions{Schemes: []string{"https"}, InsecureSkipVerify: true})
+		_, annotations, err := d.DetectFunctionalService(upstream(nil), strings.TrimPrefix(srv.URL, "https://"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(annotations).To(Equal(map[string]string{
+			swagger.AnnotationKeySwaggerURL:                srv.URL + "/swagger.json",
+			swagger.AnnotationKeySwaggerInsecureSkipVerify: "true",
+		}))
+	})
+	It("discovers functions with the headers the doc was detected with", func() {
+		srv := httptest.NewServer(protected("X-Tenant", "gloo"))
+		defer srv.Close()
+		registry := detector.NewRegistry(NewFactory(nil))
+		flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+		registry.AddFlags(flags)
+		Expect(flags.Parse([]string{"--swagger-headers=X-Tenant=gloo"})).To(Succeed())
+		detectors, err := registry.Detectors(nil, detector.Dependencies{})
+		Expect(err).NotTo(HaveOccurred())
+
+		_, annotations, err := detectors[0].DetectFunctionalService(upstream(nil), strings.TrimPrefix(srv.URL, "http://"))
+		Expect(err).NotTo(HaveOccurred())
+
+		fetch, err := FetchOptionsFrom(registry)
+		Expect(err).NotTo(HaveOccurred())
+		source := swagger.NewFunctionSource(nil, nil, nil, fetch)
+		funcs, err := source.GetFuncs(upstream(annotations), nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(funcs).NotTo(BeEmpty())
+
+		// without the header the doc can't be fetched
+		_, err = swagger.NewFunctionSource(nil, nil, nil, swagger.FetchOptions{}).GetFuncs(upstream(annotations), nil)
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,67 @@
+package updater
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	kubeerrors "k8s.io/apimachinery/pkg/api/errors"
+
+	"github.com/solo-io/gloo-function-discovery/internal/metrics"
+	"github.com/solo-io/gloo-function-discovery/pkg/backoff"
+	"github.com/solo-io/gloo/pkg/log"
+)
+
+// ConflictError is returned when an upstream could not be written because
+// it kept being modified concurrently
+type ConflictError struct {
+	Upstream string
+	Attempts int
+	Err      error
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("conflict writing upstream %v after %v attempts: %v", e.Upstream, e.Attempts, e.Err)
+}
+
+// IsConflict returns true if the error was caused by a concurrent
+// modification of the upstream
+func IsConflict(err error) bool {
+	_, ok := errors.Cause(err).(*ConflictError)
+	return ok
+}
+
+// storage backends report stale writes differently; kube returns a typed
+// conflict, the other backends report the resource version mismatch in the message
+func isResourceVersionConflict(err error) bool {
+	cause := errors.Cause(err)
+	if kubeerrors.IsConflict(cause) {
+		return true
+	}
+	msg := strings.ToLower(cause.Error())
+	return strings.Contains(msg, "resource version") || strings.Contains(msg, "resourceversion")
+}
+
+// retryOnConflict calls fn until it succeeds, fails with an error that is not
+// a conflict, or the policy is exhausted. fn must re-read the upstream each time
+func retryOnConflict(ctx context.Context, policy backoff.Policy, upstreamName string, fn func() error) error {
+	var attempts int
+	err := backoff.Retry(ctx, policy, func() error {
+		attempts++
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		if !isResourceVersionConflict(err) {
+			return backoff.Permanent(err)
+		}
+		metrics.UpstreamWriteConflicts.Inc()
+		log.Debugf("conflict writing upstream %v, retrying: %v", upstreamName, err)
+		return err
+	})
+	if err != nil && isResourceVersionConflict(err) {
+		return &ConflictError{Upstream: upstreamName, Attempts: attempts, Err: err}
+	}
+	return err
+}
@@ -0,0 +1,36 @@
+package gcf
+
+import (
+	"github.com/solo-io/gloo-api/pkg/api/types/v1"
+	"github.com/solo-io/gloo-function-discovery/pkg/functiontypes"
+	googleplugin "github.com/solo-io/gloo-plugins/google"
+	"github.com/solo-io/gloo/pkg/secretwatcher"
+)
+
+const SourceName = "gcf"
+
+type functionSource struct{}
+
+func NewFunctionSource() functiontypes.FunctionSource {
+	return &functionSource{}
+}
+
+func (s *functionSource) Name() string {
+	return SourceName
+}
+
+func (s *functionSource) Matches(us *v1.Upstream) bool {
+	return us.Type == googleplugin.UpstreamTypeGoogle
+}
+
+func (s *functionSource) SecretRefs(us *v1.Upstream) []string {
+	ref, err := GetSecretRef(us)
+	if err != nil {
+		return nil
+	}
+	return []string{ref}
+}
+
+func (s *functionSource) GetFuncs(us *v1.Upstream, secrets secretwatcher.SecretMap) ([]*v1.Function, error) {
+	return GetFuncs(us, secrets)
+}
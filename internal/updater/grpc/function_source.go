@@ -0,0 +1,118 @@
+package grpc
+
+import (
+	"context"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+	"github.com/pkg/errors"
+
+	"github.com/solo-io/gloo-api/pkg/api/types/v1"
+	grpcdetector "github.com/solo-io/gloo-function-discovery/internal/grpc"
+	"github.com/solo-io/gloo-function-discovery/pkg/functiontypes"
+	"github.com/solo-io/gloo-function-discovery/pkg/resolver"
+	grpcplugin "github.com/solo-io/gloo-plugins/grpc"
+	"github.com/solo-io/gloo/pkg/filewatcher"
+	"github.com/solo-io/gloo/pkg/secretwatcher"
+)
+
+const SourceName = "grpc"
+
+type functionSource struct {
+	resolve resolver.Resolver
+	files   func() filewatcher.Files
+	timeout time.Duration
+}
+
+// NewFunctionSource discovers the methods of upstreams that were detected as
+// grpc, from the descriptors detection stored in file storage. files provides
+// the stored descriptors, and may be nil. the services are only reflected on
+// when the upstream has no stored descriptors, timeout bounds each connection attempt
+func NewFunctionSource(resolve resolver.Resolver, files func() filewatcher.Files, timeout time.Duration) functiontypes.FunctionSource {
+	return &functionSource{resolve: resolve, files: files, timeout: timeout}
+}
+
+func (s *functionSource) Name() string {
+	return SourceName
+}
+
+func (s *functionSource) Matches(us *v1.Upstream) bool {
+	return IsGRPC(us)
+}
+
+func (s *functionSource) SecretRefs(us *v1.Upstream) []string {
+	if ref := grpcdetector.TLSSecretRef(us); ref != "" {
+		return []string{ref}
+	}
+	return nil
+}
+
+func (s *functionSource) FileRefs(us *v1.Upstream) []string {
+	if ref := grpcdetector.DescriptorsFileRefFor(us); ref != "" {
+		return []string{ref}
+	}
+	return nil
+}
+
+func (s *functionSource) GetFuncs(us *v1.Upstream, secrets secretwatcher.SecretMap) ([]*v1.Function, error) {
+	if ref := grpcdetector.DescriptorsFileRefFor(us); ref != "" && s.files != nil {
+		if file, ok := s.files()[ref]; ok {
+			return storedFuncs(us, file.Contents)
+		}
+	}
+	addr, err := s.resolve.Resolve(us)
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting grpc service")
+	}
+	if addr == "" {
+		return nil, nil
+	}
+	reflected, err := grpcdetector.Reflect(context.Background(), us, addr, secrets, s.timeout)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reflecting services on %v", addr)
+	}
+	return getFuncs(reflected.Services, reflected.Descriptors), nil
+}
+
+// storedFuncs creates the functions of the services detection found, from the
+// descriptors it stored
+func storedFuncs(us *v1.Upstream, contents []byte) ([]*v1.Function, error) {
+	props, err := grpcplugin.DecodeServiceProperties(us.ServiceInfo.Properties)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid service properties on %v", us.Name)
+	}
+	var descriptors descriptor.FileDescriptorSet
+	if err := proto.Unmarshal(contents, &descriptors); err != nil {
+		return nil, errors.Wrapf(err, "invalid descriptors in %v", props.DescriptorsFileRef)
+	}
+	return getFuncs(servicesNamed(&descriptors, props.GRPCServiceNames), &descriptors), nil
+}
+
+// servicesNamed returns the fully qualified names of the services in the descriptors
+// with one of the given fully qualified names. upstreams detected by older versions
+// store unqualified names, which only match a service if no other service shares the name
+func servicesNamed(descriptors *descriptor.FileDescriptorSet, names []string) []string {
+	wanted := make(map[string]bool)
+	for _, name := range names {
+		wanted[name] = true
+	}
+	var services []string
+	unqualified := make(map[string][]string)
+	for _, file := range descriptors.File {
+		for _, svc := range file.Service {
+			name := qualifiedName(file.GetPackage(), svc.GetName())
+			if wanted[name] {
+				services = append(services, name)
+				continue
+			}
+			unqualified[svc.GetName()] = append(unqualified[svc.GetName()], name)
+		}
+	}
+	for _, name := range names {
+		if matches := unqualified[name]; len(matches) == 1 {
+			services = append(services, matches[0])
+		}
+	}
+	return services
+}
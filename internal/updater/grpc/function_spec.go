@@ -0,0 +1,54 @@
+package grpc
+
+import (
+	"github.com/gogo/protobuf/types"
+	"github.com/pkg/errors"
+)
+
+// FunctionSpec identifies the grpc method a discovered function calls.
+// Body is a json template of the request message
+type FunctionSpec struct {
+	Package string
+	Service string
+	Method  string
+	Body    string
+}
+
+func EncodeFunctionSpec(spec FunctionSpec) *types.Struct {
+	return &types.Struct{
+		Fields: map[string]*types.Value{
+			"package": {Kind: &types.Value_StringValue{StringValue: spec.Package}},
+			"service": {Kind: &types.Value_StringValue{StringValue: spec.Service}},
+			"method":  {Kind: &types.Value_StringValue{StringValue: spec.Method}},
+			"body":    {Kind: &types.Value_StringValue{StringValue: spec.Body}},
+		},
+	}
+}
+
+func DecodeFunctionSpec(generic *types.Struct) (FunctionSpec, error) {
+	var spec FunctionSpec
+	if generic == nil {
+		return spec, errors.New("function spec cannot be empty")
+	}
+	stringField := func(key string) (string, error) {
+		v, ok := generic.Fields[key].GetKind().(*types.Value_StringValue)
+		if !ok {
+			return "", errors.Errorf("function spec field %v must be a string", key)
+		}
+		return v.StringValue, nil
+	}
+	var err error
+	if spec.Package, err = stringField("package"); err != nil {
+		return spec, err
+	}
+	if spec.Service, err = stringField("service"); err != nil {
+		return spec, err
+	}
+	if spec.Method, err = stringField("method"); err != nil {
+		return spec, err
+	}
+	if spec.Body, err = stringField("body"); err != nil {
+		return spec, err
+	}
+	return spec, nil
+}
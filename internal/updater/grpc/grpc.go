@@ -0,0 +1,188 @@
+package grpc
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+	"github.com/solo-io/gloo-api/pkg/api/types/v1"
+	grpcplugin "github.com/solo-io/gloo-plugins/grpc"
+	"github.com/solo-io/gloo/pkg/log"
+)
+
+func IsGRPC(us *v1.Upstream) bool {
+	return us.ServiceInfo != nil && us.ServiceInfo.Type == grpcplugin.ServiceTypeGRPC
+}
+
+// getFuncs creates a function for every unary method of the services
+func getFuncs(services []string, descriptors *descriptor.FileDescriptorSet) []*v1.Function {
+	wanted := make(map[string]bool)
+	for _, s := range services {
+		wanted[s] = true
+	}
+	messages, enums := indexTypes(descriptors)
+
+	var funcs []*v1.Function
+	for _, file := range descriptors.File {
+		for _, svc := range file.Service {
+			fullName := qualifiedName(file.GetPackage(), svc.GetName())
+			if !wanted[fullName] {
+				continue
+			}
+			// a file can appear more than once in the set
+			delete(wanted, fullName)
+			for _, method := range svc.Method {
+				if method.GetClientStreaming() || method.GetServerStreaming() {
+					log.Debugf("skipping streaming method %v.%v", fullName, method.GetName())
+					continue
+				}
+				g := &requestTemplateGenerator{messages: messages, enums: enums, visiting: make(map[string]bool)}
+				funcs = append(funcs, &v1.Function{
+					Name: fullName + "." + method.GetName(),
+					Spec: EncodeFunctionSpec(FunctionSpec{
+						Package: file.GetPackage(),
+						Service: svc.GetName(),
+						Method:  method.GetName(),
+						Body:    g.messageTemplate("", strings.TrimPrefix(method.GetInputType(), ".")),
+					}),
+				})
+			}
+		}
+	}
+	return funcs
+}
+
+// indexTypes maps the fully qualified name of every message and enum,
+// including nested ones, to its descriptor
+func indexTypes(descriptors *descriptor.FileDescriptorSet) (map[string]*descriptor.DescriptorProto, map[string]*descriptor.EnumDescriptorProto) {
+	messages := make(map[string]*descriptor.DescriptorProto)
+	enums := make(map[string]*descriptor.EnumDescriptorProto)
+	indexEnums := func(prefix string, enumTypes []*descriptor.EnumDescriptorProto) {
+		for _, enum := range enumTypes {
+			enums[qualifiedName(prefix, enum.GetName())] = enum
+		}
+	}
+	var index func(prefix string, msgs []*descriptor.DescriptorProto)
+	index = func(prefix string, msgs []*descriptor.DescriptorProto) {
+		for _, msg := range msgs {
+			name := qualifiedName(prefix, msg.GetName())
+			messages[name] = msg
+			indexEnums(name, msg.EnumType)
+			index(name, msg.NestedType)
+		}
+	}
+	for _, file := range descriptors.File {
+		indexEnums(file.GetPackage(), file.EnumType)
+		index(file.GetPackage(), file.MessageType)
+	}
+	return messages, enums
+}
+
+func qualifiedName(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + "." + name
+}
+
+// well known types with a scalar json representation
+var wellKnownTemplates = map[string]string{
+	"google.protobuf.Timestamp":   `""`,
+	"google.protobuf.Duration":    `""`,
+	"google.protobuf.FieldMask":   `""`,
+	"google.protobuf.StringValue": `""`,
+	"google.protobuf.BytesValue":  `""`,
+	"google.protobuf.Int64Value":  "0",
+	"google.protobuf.UInt64Value": "0",
+	"google.protobuf.Int32Value":  "0",
+	"google.protobuf.UInt32Value": "0",
+	"google.protobuf.DoubleValue": "0",
+	"google.protobuf.FloatValue":  "0",
+	"google.protobuf.BoolValue":   "false",
+	"google.protobuf.Value":       "null",
+	"google.protobuf.ListValue":   "[]",
+}
+
+// requestTemplateGenerator turns a message into a json body template, using
+// the proto3 json mapping. every field becomes a template parameter named
+// after its path in the body
+type requestTemplateGenerator struct {
+	messages map[string]*descriptor.DescriptorProto
+	enums    map[string]*descriptor.EnumDescriptorProto
+	// messages currently being expanded, used to detect cycles
+	visiting map[string]bool
+}
+
+func (g *requestTemplateGenerator) messageTemplate(parent, name string) string {
+	msg, ok := g.messages[name]
+	if !ok {
+		log.Warnf("unresolvable message type %v; ignoring", name)
+		return "{}"
+	}
+	if g.visiting[name] {
+		// cyclic reference, stop expanding here
+		return "null"
+	}
+	g.visiting[name] = true
+	defer delete(g.visiting, name)
+
+	var fields []string
+	for _, field := range msg.Field {
+		key := field.GetJsonName()
+		if key == "" {
+			key = field.GetName()
+		}
+		paramName := key
+		if parent != "" {
+			paramName = parent + "." + key
+		}
+		fields = append(fields, fmt.Sprintf(`"%v": %v`, key, g.fieldTemplate(paramName, field)))
+	}
+	// idempotency
+	sort.Strings(fields)
+	return "{" + strings.Join(fields, ",") + "}"
+}
+
+func (g *requestTemplateGenerator) fieldTemplate(paramName string, field *descriptor.FieldDescriptorProto) string {
+	typeName := strings.TrimPrefix(field.GetTypeName(), ".")
+	if field.GetLabel() == descriptor.FieldDescriptorProto_LABEL_REPEATED {
+		// map fields are repeated entry messages
+		if msg, ok := g.messages[typeName]; ok && msg.GetOptions().GetMapEntry() {
+			return fmt.Sprintf(`{{ default(%v, {}) }}`, paramName)
+		}
+		return fmt.Sprintf(`{{ default(%v, []) }}`, paramName)
+	}
+
+	switch field.GetType() {
+	case descriptor.FieldDescriptorProto_TYPE_MESSAGE, descriptor.FieldDescriptorProto_TYPE_GROUP:
+		if wellKnown, ok := wellKnownTemplates[typeName]; ok {
+			return scalarTemplate(paramName, wellKnown)
+		}
+		return g.messageTemplate(paramName, typeName)
+	case descriptor.FieldDescriptorProto_TYPE_ENUM:
+		return scalarTemplate(paramName, fmt.Sprintf(`"%v"`, g.firstEnumValue(typeName)))
+	case descriptor.FieldDescriptorProto_TYPE_STRING, descriptor.FieldDescriptorProto_TYPE_BYTES:
+		return scalarTemplate(paramName, `""`)
+	case descriptor.FieldDescriptorProto_TYPE_BOOL:
+		return scalarTemplate(paramName, "false")
+	}
+	return scalarTemplate(paramName, "0")
+}
+
+func scalarTemplate(paramName, defaultValue string) string {
+	// string needs escaping
+	if strings.HasPrefix(defaultValue, `"`) {
+		return fmt.Sprintf(`"{{ default(%v, %v) }}"`, paramName, defaultValue)
+	}
+	return fmt.Sprintf(`{{ default(%v, %v) }}`, paramName, defaultValue)
+}
+
+// enums are rendered as the name of their first value, the proto3 default
+func (g *requestTemplateGenerator) firstEnumValue(name string) string {
+	enum, ok := g.enums[name]
+	if !ok || len(enum.Value) == 0 {
+		return ""
+	}
+	return enum.Value[0].GetName()
+}
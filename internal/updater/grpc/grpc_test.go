@@ -0,0 +1,141 @@
+package grpc
+
+import (
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/solo-io/gloo-api/pkg/api/types/v1"
+	"github.com/solo-io/gloo-function-discovery/pkg/functiontypes"
+	grpcplugin "github.com/solo-io/gloo-plugins/grpc"
+	"github.com/solo-io/gloo-storage/dependencies"
+	"github.com/solo-io/gloo/pkg/filewatcher"
+)
+
+func field(name string, number int32, typ descriptor.FieldDescriptorProto_Type, typeName string) *descriptor.FieldDescriptorProto {
+	f := &descriptor.FieldDescriptorProto{
+		Name:     proto.String(name),
+		JsonName: proto.String(name),
+		Number:   proto.Int32(number),
+		Type:     typ.Enum(),
+		Label:    descriptor.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+	}
+	if typeName != "" {
+		f.TypeName = proto.String(typeName)
+	}
+	return f
+}
+
+func repeated(f *descriptor.FieldDescriptorProto) *descriptor.FieldDescriptorProto {
+	f.Label = descriptor.FieldDescriptorProto_LABEL_REPEATED.Enum()
+	return f
+}
+
+var bookstoreDescriptors = &descriptor.FileDescriptorSet{
+	File: []*descriptor.FileDescriptorProto{{
+		Name:    proto.String("bookstore.proto"),
+		Package: proto.String("bookstore"),
+		EnumType: []*descriptor.EnumDescriptorProto{{
+			Name: proto.String("Genre"),
+			Value: []*descriptor.EnumValueDescriptorProto{
+				{Name: proto.String("FICTION"), Number: proto.Int32(0)},
+				{Name: proto.String("HISTORY"), Number: proto.Int32(1)},
+			},
+		}},
+		MessageType: []*descriptor.DescriptorProto{
+			{
+				Name: proto.String("Book"),
+				Field: []*descriptor.FieldDescriptorProto{
+					field("id", 1, descriptor.FieldDescriptorProto_TYPE_INT64, ""),
+					field("title", 2, descriptor.FieldDescriptorProto_TYPE_STRING, ""),
+					field("genre", 3, descriptor.FieldDescriptorProto_TYPE_ENUM, ".bookstore.Genre"),
+					repeated(field("authors", 4, descriptor.FieldDescriptorProto_TYPE_STRING, "")),
+					field("sequel", 5, descriptor.FieldDescriptorProto_TYPE_MESSAGE, ".bookstore.Book"),
+				},
+			},
+			{
+				Name: proto.String("CreateBookRequest"),
+				Field: []*descriptor.FieldDescriptorProto{
+					field("shelf", 1, descriptor.FieldDescriptorProto_TYPE_INT64, ""),
+					field("book", 2, descriptor.FieldDescriptorProto_TYPE_MESSAGE, ".bookstore.Book"),
+				},
+			},
+		},
+		Service: []*descriptor.ServiceDescriptorProto{{
+			Name: proto.String("Bookstore"),
+			Method: []*descriptor.MethodDescriptorProto{
+				{
+					Name:       proto.String("CreateBook"),
+					InputType:  proto.String(".bookstore.CreateBookRequest"),
+					OutputType: proto.String(".bookstore.Book"),
+				},
+				{
+					Name:            proto.String("WatchBooks"),
+					InputType:       proto.String(".bookstore.CreateBookRequest"),
+					OutputType:      proto.String(".bookstore.Book"),
+					ServerStreaming: proto.Bool(true),
+				},
+			},
+		}},
+	}},
+}
+
+var _ = Describe("grpc functions", func() {
+	It("creates a function with a request template for each unary method", func() {
+		funcs := getFuncs([]string{"bookstore.Bookstore"}, bookstoreDescriptors)
+		Expect(funcs).To(HaveLen(1))
+		Expect(funcs[0].Name).To(Equal("bookstore.Bookstore.CreateBook"))
+		spec, err := DecodeFunctionSpec(funcs[0].Spec)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(spec).To(Equal(FunctionSpec{
+			Package: "bookstore",
+			Service: "Bookstore",
+			Method:  "CreateBook",
+			Body: `{"book": {"authors": {{ default(book.authors, []) }},"genre": "{{ default(book.genre, "FICTION") }}",` +
+				`"id": {{ default(book.id, 0) }},"sequel": null,"title": "{{ default(book.title, "") }}"},` +
+				`"shelf": {{ default(shelf, 0) }}}`,
+		}))
+	})
+	It("ignores services that were not reflected", func() {
+		Expect(getFuncs([]string{"other.Service"}, bookstoreDescriptors)).To(BeEmpty())
+	})
+	It("creates functions from the descriptors stored by detection", func() {
+		b, err := proto.Marshal(bookstoreDescriptors)
+		Expect(err).NotTo(HaveOccurred())
+		files := filewatcher.Files{"descriptors": &dependencies.File{Ref: "descriptors", Contents: b}}
+		us := &v1.Upstream{
+			Name: "bookstore",
+			ServiceInfo: &v1.ServiceInfo{
+				Type: grpcplugin.ServiceTypeGRPC,
+				Properties: grpcplugin.EncodeServiceProperties(grpcplugin.ServiceProperties{
+					GRPCServiceNames:   []string{"bookstore.Bookstore"},
+					DescriptorsFileRef: "descriptors",
+				}),
+			},
+		}
+		// without a resolver, the services can't be reflected on
+		source := NewFunctionSource(nil, func() filewatcher.Files { return files }, 0)
+		Expect(source.(functiontypes.FileConsumer).FileRefs(us)).To(Equal([]string{"descriptors"}))
+		funcs, err := source.GetFuncs(us, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(funcs).To(HaveLen(1))
+		Expect(funcs[0].Name).To(Equal("bookstore.Bookstore.CreateBook"))
+	})
+	It("matches services by their fully qualified name", func() {
+		descriptors := &descriptor.FileDescriptorSet{File: append([]*descriptor.FileDescriptorProto{{
+			Name:    proto.String("archive.proto"),
+			Package: proto.String("archive"),
+			Service: []*descriptor.ServiceDescriptorProto{{Name: proto.String("Bookstore")}},
+		}}, bookstoreDescriptors.File...)}
+		Expect(servicesNamed(descriptors, []string{"bookstore.Bookstore"})).To(Equal([]string{"bookstore.Bookstore"}))
+		Expect(servicesNamed(descriptors, []string{"archive.Bookstore"})).To(Equal([]string{"archive.Bookstore"}))
+		// unqualified names stored by older versions are ambiguous here
+		Expect(servicesNamed(descriptors, []string{"Bookstore"})).To(BeEmpty())
+		Expect(servicesNamed(bookstoreDescriptors, []string{"Bookstore"})).To(Equal([]string{"bookstore.Bookstore"}))
+	})
+	It("matches upstreams detected as grpc", func() {
+		Expect(IsGRPC(&v1.Upstream{})).To(BeFalse())
+		Expect(IsGRPC(&v1.Upstream{ServiceInfo: &v1.ServiceInfo{Type: grpcplugin.ServiceTypeGRPC}})).To(BeTrue())
+	})
+})
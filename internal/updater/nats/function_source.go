@@ -0,0 +1,52 @@
+package nats
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/solo-io/gloo-api/pkg/api/types/v1"
+	"github.com/solo-io/gloo-function-discovery/pkg/functiontypes"
+	"github.com/solo-io/gloo-function-discovery/pkg/resolver"
+	"github.com/solo-io/gloo/pkg/secretwatcher"
+)
+
+const (
+	SourceName = "nats"
+	// bounds each request to the monitoring endpoint, so that an endpoint that never
+	// responds doesn't block the update
+	monitoringTimeout = 10 * time.Second
+)
+
+type functionSource struct {
+	resolve   resolver.Resolver
+	retriever *ChannelRetriever
+}
+
+// NewFunctionSource discovers the channels of upstreams that were detected as
+// nats-streaming. monitoringPort is the port of the monitoring endpoint on the
+// upstream's host, 0 for the default
+func NewFunctionSource(resolve resolver.Resolver, monitoringPort int) functiontypes.FunctionSource {
+	return &functionSource{
+		resolve: resolve,
+		retriever: &ChannelRetriever{
+			Get:            (&http.Client{Timeout: monitoringTimeout}).Get,
+			MonitoringPort: monitoringPort,
+		},
+	}
+}
+
+func (s *functionSource) Name() string {
+	return SourceName
+}
+
+func (s *functionSource) Matches(us *v1.Upstream) bool {
+	return IsNatsStreaming(us)
+}
+
+func (s *functionSource) SecretRefs(us *v1.Upstream) []string {
+	return nil
+}
+
+func (s *functionSource) GetFuncs(us *v1.Upstream, _ secretwatcher.SecretMap) ([]*v1.Function, error) {
+	return s.retriever.GetFuncs(s.resolve, us)
+}
@@ -0,0 +1,142 @@
+package nats
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/pkg/errors"
+
+	"github.com/solo-io/gloo-api/pkg/api/types/v1"
+	"github.com/solo-io/gloo-function-discovery/pkg/resolver"
+	"github.com/solo-io/gloo-plugins/nats-streaming"
+)
+
+const (
+	// AnnotationKeyMonitoringURL overrides the url of the monitoring endpoint,
+	// e.g. http://nats-streaming:8222
+	AnnotationKeyMonitoringURL = "gloo.solo.io/nats_monitoring_url"
+
+	// default port of the nats-streaming monitoring endpoint
+	DefaultMonitoringPort = 8222
+
+	channelszPath = "/streaming/channelsz"
+	// max page size allowed by nats-streaming
+	channelszLimit = 1024
+)
+
+// the response of /streaming/channelsz without ?subs=1
+type channelsz struct {
+	ClusterID string   `json:"cluster_id"`
+	Offset    int      `json:"offset"`
+	Limit     int      `json:"limit"`
+	Count     int      `json:"count"`
+	Total     int      `json:"total"`
+	Names     []string `json:"names"`
+}
+
+func IsNatsStreaming(us *v1.Upstream) bool {
+	return us.ServiceInfo != nil && us.ServiceInfo.Type == natsstreaming.ServiceTypeNatsStreaming
+}
+
+// ChannelRetriever lists the channels of a nats-streaming server
+type ChannelRetriever struct {
+	Get            func(url string) (*http.Response, error)
+	MonitoringPort int
+}
+
+func (cr *ChannelRetriever) GetFuncs(resolve resolver.Resolver, us *v1.Upstream) ([]*v1.Function, error) {
+	if !IsNatsStreaming(us) {
+		return nil, nil
+	}
+
+	monitoringURL, err := cr.monitoringURL(resolve, us)
+	if err != nil {
+		return nil, err
+	}
+	if monitoringURL == "" {
+		return nil, nil
+	}
+
+	channels, err := cr.listChannels(monitoringURL)
+	if err != nil {
+		return nil, errors.Wrap(err, "error fetching channels")
+	}
+
+	var funcs []*v1.Function
+	for _, channel := range channels {
+		if channel != "" {
+			// the nats-streaming plugin publishes to the subject named by the function
+			funcs = append(funcs, &v1.Function{Name: channel})
+		}
+	}
+	return funcs, nil
+}
+
+// the monitoring endpoint is served on the same host as the client port
+func (cr *ChannelRetriever) monitoringURL(resolve resolver.Resolver, us *v1.Upstream) (string, error) {
+	if us.Metadata != nil {
+		if override := us.Metadata.Annotations[AnnotationKeyMonitoringURL]; override != "" {
+			return override, nil
+		}
+	}
+	addr, err := resolve.Resolve(us)
+	if err != nil {
+		return "", errors.Wrap(err, "error getting nats-streaming service")
+	}
+	if addr == "" {
+		return "", nil
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", errors.Wrapf(err, "invalid address %v", addr)
+	}
+	port := cr.MonitoringPort
+	if port == 0 {
+		port = DefaultMonitoringPort
+	}
+	return "http://" + net.JoinHostPort(host, strconv.Itoa(port)), nil
+}
+
+func (cr *ChannelRetriever) listChannels(monitoringURL string) ([]string, error) {
+	u, err := url.Parse(monitoringURL)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid monitoring url %v", monitoringURL)
+	}
+	u.Path = channelszPath
+
+	var names []string
+	for offset := 0; ; {
+		u.RawQuery = url.Values{
+			"offset": {strconv.Itoa(offset)},
+			"limit":  {strconv.Itoa(channelszLimit)},
+		}.Encode()
+		page, err := cr.getChannelsz(u.String())
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, page.Names...)
+		offset += len(page.Names)
+		if len(page.Names) == 0 || offset >= page.Total {
+			return names, nil
+		}
+	}
+}
+
+func (cr *ChannelRetriever) getChannelsz(url string) (*channelsz, error) {
+	res, err := cr.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("GET %v returned %v", url, res.Status)
+	}
+	var page channelsz
+	if err := json.NewDecoder(res.Body).Decode(&page); err != nil {
+		return nil, errors.Wrapf(err, "decoding response from %v", url)
+	}
+	return &page, nil
+}
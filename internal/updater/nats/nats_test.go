@@ -0,0 +1,99 @@
+package nats
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/solo-io/gloo-api/pkg/api/types/v1"
+	"github.com/solo-io/gloo-plugins/nats-streaming"
+)
+
+type mockResolve struct {
+	result string
+}
+
+func (m *mockResolve) Resolve(us *v1.Upstream) (string, error) {
+	return m.result, nil
+}
+
+func natsUpstream(annotations map[string]string) *v1.Upstream {
+	return &v1.Upstream{
+		Name:     "nats",
+		Metadata: &v1.Metadata{Annotations: annotations},
+		ServiceInfo: &v1.ServiceInfo{
+			Type: natsstreaming.ServiceTypeNatsStreaming,
+		},
+	}
+}
+
+var _ = Describe("Nats channel discovery", func() {
+	var (
+		srv      *httptest.Server
+		channels []string
+		requests []string
+	)
+	BeforeEach(func() {
+		requests = nil
+		srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != channelszPath {
+				http.NotFound(w, r)
+				return
+			}
+			requests = append(requests, r.URL.RawQuery)
+			// serve pages of two to exercise paging
+			offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+			end := offset + 2
+			if end > len(channels) {
+				end = len(channels)
+			}
+			json.NewEncoder(w).Encode(channelsz{
+				ClusterID: "test-cluster",
+				Offset:    offset,
+				Count:     end - offset,
+				Total:     len(channels),
+				Names:     channels[offset:end],
+			})
+		}))
+	})
+	AfterEach(func() {
+		srv.Close()
+	})
+
+	It("creates a function for each channel", func() {
+		channels = []string{"orders", "payments", "users.created"}
+		cr := &ChannelRetriever{Get: http.Get}
+		us := natsUpstream(map[string]string{AnnotationKeyMonitoringURL: srv.URL})
+		funcs, err := cr.GetFuncs(&mockResolve{}, us)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(funcs).To(Equal([]*v1.Function{
+			{Name: "orders"},
+			{Name: "payments"},
+			{Name: "users.created"},
+		}))
+		Expect(requests).To(HaveLen(2))
+	})
+
+	It("uses the monitoring port on the resolved host", func() {
+		channels = []string{"orders"}
+		host, port, _ := net.SplitHostPort(strings.TrimPrefix(srv.URL, "http://"))
+		monitoringPort, _ := strconv.Atoi(port)
+		cr := &ChannelRetriever{Get: http.Get, MonitoringPort: monitoringPort}
+		funcs, err := cr.GetFuncs(&mockResolve{result: host + ":4222"}, natsUpstream(nil))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(funcs).To(Equal([]*v1.Function{{Name: "orders"}}))
+	})
+
+	It("ignores upstreams that are not nats-streaming", func() {
+		cr := &ChannelRetriever{Get: http.Get}
+		funcs, err := cr.GetFuncs(&mockResolve{result: "localhost:4222"}, &v1.Upstream{Name: "other"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(funcs).To(BeNil())
+	})
+})
@@ -0,0 +1,34 @@
+package openfaas
+
+import (
+	"github.com/solo-io/gloo-api/pkg/api/types/v1"
+	"github.com/solo-io/gloo-function-discovery/pkg/functiontypes"
+	"github.com/solo-io/gloo-function-discovery/pkg/resolver"
+	"github.com/solo-io/gloo/pkg/secretwatcher"
+)
+
+const SourceName = "openfaas"
+
+type functionSource struct {
+	resolve resolver.Resolver
+}
+
+func NewFunctionSource(resolve resolver.Resolver) functiontypes.FunctionSource {
+	return &functionSource{resolve: resolve}
+}
+
+func (s *functionSource) Name() string {
+	return SourceName
+}
+
+func (s *functionSource) Matches(us *v1.Upstream) bool {
+	return IsOpenFaas(us)
+}
+
+func (s *functionSource) SecretRefs(us *v1.Upstream) []string {
+	return nil
+}
+
+func (s *functionSource) GetFuncs(us *v1.Upstream, _ secretwatcher.SecretMap) ([]*v1.Function, error) {
+	return GetFuncs(s.resolve, us)
+}
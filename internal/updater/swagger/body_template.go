@@ -0,0 +1,197 @@
+package swagger
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/go-openapi/spec"
+	"github.com/solo-io/gloo/pkg/log"
+)
+
+// bodyTemplateGenerator turns a json schema into a json body template.
+// every leaf of the schema becomes a template parameter named after its
+// path in the body, defaulting to the schema default for its type
+type bodyTemplateGenerator struct {
+	definitions spec.Definitions
+	// refs currently being expanded, used to detect cycles
+	visiting map[string]bool
+}
+
+func getBodyTemplate(paramName string, schema *spec.Schema, definitions spec.Definitions) string {
+	if schema == nil {
+		return ""
+	}
+	g := &bodyTemplateGenerator{
+		definitions: definitions,
+		visiting:    make(map[string]bool),
+	}
+	resolved, release, ok := g.resolve(*schema)
+	if !ok {
+		return "{}"
+	}
+	defer release()
+	// top level properties are referenced by their own names
+	if isObjectSchema(resolved) {
+		return g.objectTemplate("", resolved)
+	}
+	return g.template(paramName, resolved)
+}
+
+func (g *bodyTemplateGenerator) template(paramName string, schema spec.Schema) string {
+	schema, release, ok := g.resolve(schema)
+	if !ok {
+		// cyclic reference, stop expanding here
+		return "null"
+	}
+	defer release()
+
+	switch {
+	case isObjectSchema(schema):
+		return g.objectTemplate(paramName, schema)
+	case schema.Type.Contains("array"):
+		return g.arrayTemplate(paramName, schema)
+	case schema.Type.Contains("string"):
+		// string needs escaping
+		return fmt.Sprintf(`"{{ default(%v, %v) }}"`, paramName, defaultValue(schema, `""`))
+	case schema.Type.Contains("integer"), schema.Type.Contains("number"):
+		return fmt.Sprintf(`{{ default(%v, %v) }}`, paramName, defaultValue(schema, "0"))
+	case schema.Type.Contains("boolean"):
+		return fmt.Sprintf(`{{ default(%v, %v) }}`, paramName, defaultValue(schema, "false"))
+	}
+	// untyped schema, any json value is valid
+	return fmt.Sprintf(`{{ default(%v, %v) }}`, paramName, defaultValue(schema, "null"))
+}
+
+func (g *bodyTemplateGenerator) objectTemplate(parent string, schema spec.Schema) string {
+	var fields []string
+	for key, prop := range schema.Properties {
+		paramName := key
+		if parent != "" {
+			paramName = parent + "." + key
+		}
+		fields = append(fields, fmt.Sprintf(`"%v": %v`, key, g.template(paramName, prop)))
+	}
+	// idempotency
+	sort.Strings(fields)
+	return "{" + strings.Join(fields, ",") + "}"
+}
+
+// arrays of objects are templated as a single element, so that the fields of the
+// element become parameters. other arrays are a parameter themselves
+func (g *bodyTemplateGenerator) arrayTemplate(paramName string, schema spec.Schema) string {
+	whole := fmt.Sprintf(`{{ default(%v, %v) }}`, paramName, defaultValue(schema, "[]"))
+	if schema.Default != nil || schema.Items == nil || schema.Items.Schema == nil {
+		return whole
+	}
+	items, release, ok := g.resolve(*schema.Items.Schema)
+	if !ok {
+		// cyclic reference, stop expanding here
+		return "[]"
+	}
+	defer release()
+	if !isObjectSchema(items) {
+		return whole
+	}
+	return "[" + g.objectTemplate(paramName, items) + "]"
+}
+
+// resolve follows refs and flattens allOf, oneOf and anyOf into a single schema.
+// release must be called once the resolved schema has been fully expanded.
+// ok is false if the schema refers back to a schema that is still being expanded
+func (g *bodyTemplateGenerator) resolve(schema spec.Schema) (resolved spec.Schema, release func(), ok bool) {
+	var expanding []string
+	release = func() {
+		for _, name := range expanding {
+			delete(g.visiting, name)
+		}
+	}
+	for schema.Ref.String() != "" {
+		name := definitionName(schema.Ref)
+		if g.visiting[name] {
+			release()
+			return spec.Schema{}, func() {}, false
+		}
+		def, found := g.definitions[name]
+		if !found {
+			log.Warnf("unresolvable schema ref %v; ignoring", schema.Ref.String())
+			return spec.Schema{}, release, true
+		}
+		g.visiting[name] = true
+		expanding = append(expanding, name)
+		schema = def
+	}
+
+	if len(schema.AllOf) > 0 {
+		merged := schema
+		merged.AllOf = nil
+		merged.Properties = make(map[string]spec.Schema)
+		for key, prop := range schema.Properties {
+			merged.Properties[key] = prop
+		}
+		for _, sub := range schema.AllOf {
+			subResolved, subRelease, subOk := g.resolve(sub)
+			if !subOk {
+				continue
+			}
+			for key, prop := range subResolved.Properties {
+				merged.Properties[key] = prop
+			}
+			if len(merged.Type) == 0 {
+				merged.Type = subResolved.Type
+			}
+			subRelease()
+		}
+		if len(merged.Type) == 0 && len(merged.Properties) > 0 {
+			merged.Type = spec.StringOrArray{"object"}
+		}
+		schema = merged
+	}
+
+	// the first alternative serves as the template for oneOf and anyOf
+	var alternatives []spec.Schema
+	switch {
+	case len(schema.OneOf) > 0:
+		alternatives = schema.OneOf
+	case len(schema.AnyOf) > 0:
+		alternatives = schema.AnyOf
+	}
+	if len(alternatives) > 0 {
+		alternative, altRelease, altOk := g.resolve(alternatives[0])
+		if !altOk {
+			release()
+			return spec.Schema{}, func() {}, false
+		}
+		return alternative, func() {
+			altRelease()
+			release()
+		}, true
+	}
+
+	return schema, release, true
+}
+
+func isObjectSchema(schema spec.Schema) bool {
+	return schema.Type.Contains("object") || (len(schema.Type) == 0 && len(schema.Properties) > 0)
+}
+
+// defaultValue renders the schema's default (or first enum value) as a json literal
+func defaultValue(schema spec.Schema, typeDefault string) string {
+	value := schema.Default
+	if value == nil && len(schema.Enum) > 0 {
+		value = schema.Enum[0]
+	}
+	if value == nil {
+		return typeDefault
+	}
+	b, err := json.Marshal(value)
+	if err != nil {
+		return typeDefault
+	}
+	return string(b)
+}
+
+func definitionName(ref spec.Ref) string {
+	return strings.TrimPrefix(ref.String(), swaggerDefinitionRefPrefix)
+}
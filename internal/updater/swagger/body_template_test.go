@@ -0,0 +1,82 @@
+package swagger
+
+import (
+	"encoding/json"
+
+	"github.com/go-openapi/spec"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func mustSchema(jsn string) *spec.Schema {
+	var schema spec.Schema
+	err := json.Unmarshal([]byte(jsn), &schema)
+	Expect(err).NotTo(HaveOccurred())
+	return &schema
+}
+
+var _ = Describe("BodyTemplate", func() {
+	var definitions spec.Definitions
+	BeforeEach(func() {
+		definitions = spec.Definitions{
+			"Tag": *mustSchema(`{"type": "object", "properties": {"name": {"type": "string", "default": "none"}}}`),
+			"Pet": *mustSchema(`{
+				"allOf": [
+					{"$ref": "#/definitions/NewPet"},
+					{"properties": {"id": {"type": "integer"}}}
+				]
+			}`),
+			"NewPet": *mustSchema(`{
+				"type": "object",
+				"properties": {
+					"name": {"type": "string"},
+					"tag": {"$ref": "#/definitions/Tag"},
+					"owner": {"type": "object", "properties": {"age": {"type": "number"}}},
+					"vaccinated": {"type": "boolean"},
+					"aliases": {"type": "array", "items": {"type": "string"}},
+					"kind": {"oneOf": [{"type": "string", "enum": ["cat", "dog"]}, {"type": "integer"}]}
+				}
+			}`),
+			"Node": *mustSchema(`{"type": "object", "properties": {"next": {"$ref": "#/definitions/Node"}}}`),
+			"Tree": *mustSchema(`{"type": "object", "properties": {
+				"name": {"type": "string"},
+				"children": {"type": "array", "items": {"$ref": "#/definitions/Tree"}}
+			}}`),
+		}
+	})
+	It("follows the body parameter schema ref", func() {
+		body := getBodyTemplate("body", mustSchema(`{"$ref": "#/definitions/Tag"}`), definitions)
+		Expect(body).To(Equal(`{"name": "{{ default(name, "none") }}"}`))
+	})
+	It("expands nested objects, arrays, allOf and oneOf with typed defaults", func() {
+		body := getBodyTemplate("body", mustSchema(`{"$ref": "#/definitions/Pet"}`), definitions)
+		Expect(body).To(Equal(`{` +
+			`"aliases": {{ default(aliases, []) }},` +
+			`"id": {{ default(id, 0) }},` +
+			`"kind": "{{ default(kind, "cat") }}",` +
+			`"name": "{{ default(name, "") }}",` +
+			`"owner": {"age": {{ default(owner.age, 0) }}},` +
+			`"tag": {"name": "{{ default(tag.name, "none") }}"},` +
+			`"vaccinated": {{ default(vaccinated, false) }}` +
+			`}`))
+	})
+	It("stops expanding cyclic refs", func() {
+		body := getBodyTemplate("body", mustSchema(`{"$ref": "#/definitions/Node"}`), definitions)
+		Expect(body).To(Equal(`{"next": null}`))
+	})
+	It("expands the items of arrays of objects", func() {
+		body := getBodyTemplate("body", mustSchema(`{"type": "object", "properties": {
+			"tags": {"type": "array", "items": {"$ref": "#/definitions/Tag"}},
+			"defaults": {"type": "array", "items": {"$ref": "#/definitions/Tag"}, "default": []}
+		}}`), definitions)
+		Expect(body).To(Equal(`{"defaults": {{ default(defaults, []) }},"tags": [{"name": "{{ default(tags.name, "none") }}"}]}`))
+	})
+	It("stops expanding cyclic array items", func() {
+		body := getBodyTemplate("body", mustSchema(`{"$ref": "#/definitions/Tree"}`), definitions)
+		Expect(body).To(Equal(`{"children": [],"name": "{{ default(name, "") }}"}`))
+	})
+	It("templates non-object bodies by parameter name", func() {
+		body := getBodyTemplate("names", mustSchema(`{"type": "array", "items": {"type": "string"}}`), definitions)
+		Expect(body).To(Equal(`{{ default(names, []) }}`))
+	})
+})
@@ -0,0 +1,43 @@
+package swagger
+
+import "strings"
+
+const (
+	contentTypeJSON          = "application/json"
+	contentTypeFormURLEncode = "application/x-www-form-urlencoded"
+	contentTypeMultipartForm = "multipart/form-data"
+)
+
+// negotiateContentType picks the json content type to use from an operation's
+// consumes or produces list. operations that don't declare content types
+// are assumed to speak json
+func negotiateContentType(contentTypes []string) (string, bool) {
+	if len(contentTypes) == 0 {
+		return contentTypeJSON, true
+	}
+	for _, contentType := range contentTypes {
+		if mediaType(contentType) == contentTypeJSON {
+			return contentType, true
+		}
+	}
+	// vendor types such as application/vnd.api+json
+	for _, contentType := range contentTypes {
+		if strings.HasSuffix(mediaType(contentType), "+json") {
+			return contentType, true
+		}
+	}
+	return "", false
+}
+
+// strip parameters such as charset from a content type
+func mediaType(contentType string) string {
+	return strings.TrimSpace(strings.Split(contentType, ";")[0])
+}
+
+func isFormContentType(contentType string) bool {
+	switch mediaType(contentType) {
+	case contentTypeFormURLEncode, contentTypeMultipartForm:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,169 @@
+package swagger
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/go-openapi/spec"
+	"github.com/solo-io/gloo/pkg/log"
+)
+
+// DocCache shares parsed swagger docs between detection and function discovery.
+// docs are reused for ttl, then revalidated with a conditional request. they are
+// kept until CollectGarbage finds their url is no longer used
+type DocCache struct {
+	ttl time.Duration
+
+	docs map[string]*cachedDoc
+	m    sync.Mutex
+}
+
+type cachedDoc struct {
+	url     string
+	spec    *spec.Swagger
+	version string
+	// whether the doc refers to other documents
+	external bool
+	// validators of the response the doc was parsed from
+	etag         string
+	lastModified string
+	validated    time.Time
+}
+
+func NewDocCache(ttl time.Duration) *DocCache {
+	return &DocCache{
+		ttl:  ttl,
+		docs: make(map[string]*cachedDoc),
+	}
+}
+
+// SetTTL changes how long docs are reused, for caches created before it is known
+func (c *DocCache) SetTTL(ttl time.Duration) {
+	c.m.Lock()
+	c.ttl = ttl
+	c.m.Unlock()
+}
+
+// CollectGarbage forgets the docs at urls that are not in the list, which must
+// contain every url docs are still fetched from
+func (c *DocCache) CollectGarbage(urls []string) {
+	if c == nil {
+		return
+	}
+	inUse := make(map[string]bool)
+	for _, url := range urls {
+		inUse[url] = true
+	}
+	c.m.Lock()
+	defer c.m.Unlock()
+	for key, doc := range c.docs {
+		if !inUse[doc.url] {
+			delete(c.docs, key)
+		}
+	}
+}
+
+// Get returns the doc at the http url, and a version that changes whenever the
+// contents of the doc or the documents it refers to do. the returned spec is shared
+// and must not be modified. a nil cache fetches the doc on every call
+func (c *DocCache) Get(url string, opts FetchOptions) (*spec.Swagger, string, error) {
+	if c == nil {
+		res, err := fetch(url, opts, nil)
+		if err != nil {
+			return nil, "", err
+		}
+		return loadSwaggerDoc(res.body, url, refLoader(url, opts))
+	}
+
+	// docs fetched with different credentials or headers are kept apart
+	key := url + "#" + opts.fingerprint()
+	c.m.Lock()
+	cached, ok := c.docs[key]
+	ttl := c.ttl
+	c.m.Unlock()
+	if ok && time.Since(cached.validated) < ttl {
+		return cached.spec, cached.version, nil
+	}
+
+	// the validators only cover the doc itself, docs with external refs are reloaded
+	var conditional *cachedDoc
+	if ok && !cached.external {
+		conditional = cached
+	}
+	res, err := fetch(url, opts, conditional)
+	if err != nil {
+		return nil, "", err
+	}
+	if res.notModified {
+		log.Debugf("swagger doc at %v not modified", url)
+		c.store(url, key, &cachedDoc{
+			spec:         cached.spec,
+			version:      cached.version,
+			etag:         cached.etag,
+			lastModified: cached.lastModified,
+			validated:    time.Now(),
+		})
+		return cached.spec, cached.version, nil
+	}
+	// servers without validators send the doc every time, only parse it if it changed
+	if conditional != nil && docVersion(res.body) == cached.version {
+		c.store(url, key, &cachedDoc{
+			spec:         cached.spec,
+			version:      cached.version,
+			etag:         res.etag,
+			lastModified: res.lastModified,
+			validated:    time.Now(),
+		})
+		return cached.spec, cached.version, nil
+	}
+	swaggerSpec, version, err := loadSwaggerDoc(res.body, url, refLoader(url, opts))
+	if err != nil {
+		return nil, "", err
+	}
+	if ok && version == cached.version {
+		swaggerSpec = cached.spec
+	}
+	c.store(url, key, &cachedDoc{
+		spec:    swaggerSpec,
+		version: version,
+		// the version covers more than the doc if other documents were loaded
+		external:     version != docVersion(res.body),
+		etag:         res.etag,
+		lastModified: res.lastModified,
+		validated:    time.Now(),
+	})
+	return swaggerSpec, version, nil
+}
+
+// entries are replaced rather than modified, as they are read without the lock
+func (c *DocCache) store(url, key string, doc *cachedDoc) {
+	doc.url = url
+	c.m.Lock()
+	c.docs[key] = doc
+	c.m.Unlock()
+}
+
+// identifies the headers, credentials and tls settings of a request
+func (opts FetchOptions) fingerprint() string {
+	// maps are encoded with sorted keys
+	b, _ := json.Marshal(opts)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// hashes the contents of a doc and the documents it refers to
+func docVersion(docs ...[]byte) string {
+	if len(docs) == 1 {
+		sum := sha256.Sum256(docs[0])
+		return hex.EncodeToString(sum[:])
+	}
+	h := sha256.New()
+	for _, doc := range docs {
+		sum := sha256.Sum256(doc)
+		h.Write(sum[:])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
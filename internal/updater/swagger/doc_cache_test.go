@@ -0,0 +1,124 @@
+package swagger_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/solo-io/gloo-api/pkg/api/types/v1"
+	. "github.com/solo-io/gloo-function-discovery/internal/updater/swagger"
+)
+
+var _ = Describe("DocCache", func() {
+	var (
+		srv *httptest.Server
+		// requests and full responses served
+		requests, served int32
+		etag             atomic.Value
+		doc              atomic.Value
+	)
+	BeforeEach(func() {
+		requests, served = 0, 0
+		etag.Store(`"v1"`)
+		doc.Store(swaggerDoc)
+		srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&requests, 1)
+			current := etag.Load().(string)
+			if r.Header.Get("If-None-Match") == current {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			atomic.AddInt32(&served, 1)
+			w.Header().Set("ETag", current)
+			fmt.Fprint(w, doc.Load().(string))
+		}))
+	})
+	AfterEach(func() {
+		srv.Close()
+	})
+
+	It("reuses docs within the ttl", func() {
+		cache := NewDocCache(time.Hour)
+		first, version, err := cache.Get(srv.URL, FetchOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		second, secondVersion, err := cache.Get(srv.URL, FetchOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(second).To(BeIdenticalTo(first))
+		Expect(secondVersion).To(Equal(version))
+		Expect(atomic.LoadInt32(&requests)).To(Equal(int32(1)))
+	})
+	It("forgets docs at urls that are no longer used", func() {
+		cache := NewDocCache(time.Hour)
+		_, _, err := cache.Get(srv.URL, FetchOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		cache.CollectGarbage([]string{srv.URL})
+		_, _, err = cache.Get(srv.URL, FetchOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(atomic.LoadInt32(&requests)).To(Equal(int32(1)))
+
+		cache.CollectGarbage(nil)
+		_, _, err = cache.Get(srv.URL, FetchOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(atomic.LoadInt32(&served)).To(Equal(int32(2)))
+	})
+	It("revalidates expired docs with a conditional request", func() {
+		cache := NewDocCache(0)
+		first, version, err := cache.Get(srv.URL, FetchOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		second, secondVersion, err := cache.Get(srv.URL, FetchOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(second).To(BeIdenticalTo(first))
+		Expect(secondVersion).To(Equal(version))
+		Expect(atomic.LoadInt32(&requests)).To(Equal(int32(2)))
+		Expect(atomic.LoadInt32(&served)).To(Equal(int32(1)))
+
+		etag.Store(`"v2"`)
+		doc.Store(responseDoc)
+		_, changedVersion, err := cache.Get(srv.URL, FetchOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changedVersion).NotTo(Equal(version))
+	})
+	It("does not share docs between requests with different credentials", func() {
+		protected := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer s3cret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			fmt.Fprint(w, swaggerDoc)
+		}))
+		defer protected.Close()
+		cache := NewDocCache(time.Hour)
+		_, _, err := cache.Get(protected.URL, FetchOptions{Auth: &Auth{Token: "s3cret"}})
+		Expect(err).NotTo(HaveOccurred())
+		_, _, err = cache.Get(protected.URL, FetchOptions{})
+		Expect(err).To(HaveOccurred())
+		_, _, err = cache.Get(protected.URL, FetchOptions{Auth: &Auth{Token: "wrong"}})
+		Expect(err).To(HaveOccurred())
+	})
+	It("only regenerates functions when the doc changes", func() {
+		source := NewFunctionSource(NewDocCache(0), nil, nil, FetchOptions{})
+		us := &v1.Upstream{
+			Name: "cached",
+			Metadata: &v1.Metadata{Annotations: map[string]string{
+				AnnotationKeySwaggerURL: srv.URL,
+			}},
+		}
+		funcs, err := source.GetFuncs(us, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(funcs).NotTo(BeEmpty())
+		// modifying returned functions doesn't affect the cache
+		funcs[0].Name = "modified"
+		again, err := source.GetFuncs(us, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(again).To(HaveLen(len(funcs)))
+		for _, fn := range again {
+			Expect(fn.Name).NotTo(Equal("modified"))
+		}
+		Expect(atomic.LoadInt32(&served)).To(Equal(int32(1)))
+	})
+})
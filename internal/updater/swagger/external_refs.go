@@ -0,0 +1,302 @@
+package swagger
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// maximum number of documents loaded to resolve the external refs of a doc
+const maxExternalDocs = 20
+
+// loads a document a doc refers to, given its absolute location
+type docLoader func(location string) ([]byte, error)
+
+type refKind int
+
+const (
+	schemaRef refKind = iota
+	// parameters, responses, request bodies and path items are inlined, as
+	// they are only resolved within the doc after parsing
+	inlinedRef
+)
+
+var invalidDefinitionChars = regexp.MustCompile(`[^A-Za-z0-9_.-]`)
+
+// externalRefResolver rewrites a doc so that it only contains local refs.
+// schemas referenced in other documents are imported as definitions of the doc,
+// which also takes care of cyclic schemas. other objects are inlined
+type externalRefResolver struct {
+	rootLocation string
+	load         docLoader
+	// parsed documents, by location
+	docs map[string]interface{}
+	// contents of the documents that were loaded, in order
+	loaded [][]byte
+
+	definitions         map[string]interface{}
+	definitionRefPrefix string
+	// names of the definitions imported for absolute refs
+	imported map[string]string
+	// absolute refs that are being inlined, to detect loops
+	inlining map[string]bool
+}
+
+// resolveExternalRefs resolves the refs to other documents in the json doc found at
+// location. it returns the resolved doc and the contents of the documents it loaded
+func resolveExternalRefs(jsn []byte, location string, load docLoader) ([]byte, [][]byte, error) {
+	var root map[string]interface{}
+	if err := json.Unmarshal(jsn, &root); err != nil {
+		return nil, nil, errors.Wrap(err, "invalid swagger doc")
+	}
+	base, err := url.Parse(location)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "invalid swagger doc location %v", location)
+	}
+	base.Fragment = ""
+
+	r := &externalRefResolver{
+		rootLocation: base.String(),
+		load:         load,
+		docs:         map[string]interface{}{base.String(): root},
+		imported:     make(map[string]string),
+		inlining:     make(map[string]bool),
+	}
+	r.definitions, r.definitionRefPrefix = definitionsOf(root)
+
+	if _, err := r.walk(root, base, schemaRef); err != nil {
+		return nil, nil, err
+	}
+	if len(r.loaded) == 0 {
+		return jsn, nil, nil
+	}
+	resolved, err := json.Marshal(root)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "encoding resolved swagger doc")
+	}
+	return resolved, r.loaded, nil
+}
+
+// returns the map schemas are defined in, creating it if necessary
+func definitionsOf(root map[string]interface{}) (map[string]interface{}, string) {
+	parent, key, prefix := root, "definitions", swaggerDefinitionRefPrefix
+	if version, ok := root["openapi"].(string); ok && strings.HasPrefix(version, "3.") {
+		components, ok := root["components"].(map[string]interface{})
+		if !ok {
+			components = make(map[string]interface{})
+			root["components"] = components
+		}
+		parent, key, prefix = components, "schemas", openAPI3SchemaRefPrefix
+	}
+	definitions, ok := parent[key].(map[string]interface{})
+	if !ok {
+		definitions = make(map[string]interface{})
+		parent[key] = definitions
+	}
+	return definitions, prefix
+}
+
+// walk resolves the refs in node, which is part of the doc at base. it returns the
+// node to replace node with
+func (r *externalRefResolver) walk(node interface{}, base *url.URL, kind refKind) (interface{}, error) {
+	switch n := node.(type) {
+	case map[string]interface{}:
+		if ref, ok := n["$ref"].(string); ok {
+			return r.resolveRef(ref, base, kind)
+		}
+		for key, value := range n {
+			resolved, err := r.walkField(key, value, base)
+			if err != nil {
+				return nil, err
+			}
+			n[key] = resolved
+		}
+	case []interface{}:
+		for i, elem := range n {
+			resolved, err := r.walk(elem, base, schemaRef)
+			if err != nil {
+				return nil, err
+			}
+			n[i] = resolved
+		}
+	}
+	return node, nil
+}
+
+func (r *externalRefResolver) walkField(key string, value interface{}, base *url.URL) (interface{}, error) {
+	switch {
+	case key == "example", key == "examples", strings.HasPrefix(key, "x-"):
+		// arbitrary values, refs in them mean nothing
+		return value, nil
+	case key == "parameters", key == "responses", key == "requestBodies", key == "paths":
+		return r.walkEach(value, base, inlinedRef)
+	case key == "properties", key == "patternProperties", key == "definitions", key == "schemas":
+		return r.walkEach(value, base, schemaRef)
+	case key == "requestBody":
+		return r.walk(value, base, inlinedRef)
+	}
+	return r.walk(value, base, schemaRef)
+}
+
+// walks the values of a map or array of objects of the same kind
+func (r *externalRefResolver) walkEach(container interface{}, base *url.URL, kind refKind) (interface{}, error) {
+	switch c := container.(type) {
+	case map[string]interface{}:
+		for key, value := range c {
+			resolved, err := r.walk(value, base, kind)
+			if err != nil {
+				return nil, err
+			}
+			c[key] = resolved
+		}
+	case []interface{}:
+		for i, elem := range c {
+			resolved, err := r.walk(elem, base, kind)
+			if err != nil {
+				return nil, err
+			}
+			c[i] = resolved
+		}
+	}
+	return container, nil
+}
+
+func (r *externalRefResolver) resolveRef(ref string, base *url.URL, kind refKind) (interface{}, error) {
+	target, err := base.Parse(ref)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid ref %v", ref)
+	}
+	pointer := target.Fragment
+	target.Fragment = ""
+	location := target.String()
+	if location == r.rootLocation {
+		// the doc resolves its own refs
+		return map[string]interface{}{"$ref": "#" + pointer}, nil
+	}
+	absRef := location + "#" + pointer
+
+	if kind == schemaRef {
+		if name, ok := r.imported[absRef]; ok {
+			return map[string]interface{}{"$ref": r.definitionRefPrefix + name}, nil
+		}
+		// registered before walking the schema, so that refs back to it end here
+		name := r.definitionName(target, pointer)
+		r.imported[absRef] = name
+		r.definitions[name] = map[string]interface{}{}
+		value, err := r.lookup(location, pointer)
+		if err != nil {
+			return nil, err
+		}
+		resolved, err := r.walk(value, target, schemaRef)
+		if err != nil {
+			return nil, err
+		}
+		r.definitions[name] = resolved
+		return map[string]interface{}{"$ref": r.definitionRefPrefix + name}, nil
+	}
+
+	if r.inlining[absRef] {
+		return nil, errors.Errorf("ref loop at %v", absRef)
+	}
+	r.inlining[absRef] = true
+	defer delete(r.inlining, absRef)
+	value, err := r.lookup(location, pointer)
+	if err != nil {
+		return nil, err
+	}
+	return r.walk(value, target, kind)
+}
+
+// returns a copy of the value at the json pointer in the doc at location
+func (r *externalRefResolver) lookup(location, pointer string) (interface{}, error) {
+	doc, err := r.document(location)
+	if err != nil {
+		return nil, err
+	}
+	value := doc
+	if pointer != "" {
+		if !strings.HasPrefix(pointer, "/") {
+			return nil, errors.Errorf("invalid json pointer %v in ref to %v", pointer, location)
+		}
+		for _, token := range strings.Split(pointer[1:], "/") {
+			token = strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+			switch v := value.(type) {
+			case map[string]interface{}:
+				value = v[token]
+			case []interface{}:
+				i, err := strconv.Atoi(token)
+				if err != nil || i < 0 || i >= len(v) {
+					return nil, errors.Errorf("%v#%v not found", location, pointer)
+				}
+				value = v[i]
+			default:
+				value = nil
+			}
+			if value == nil {
+				return nil, errors.Errorf("%v#%v not found", location, pointer)
+			}
+		}
+	}
+	// the value is modified while resolving it, and may be referred to more than once
+	b, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var copied interface{}
+	if err := json.Unmarshal(b, &copied); err != nil {
+		return nil, err
+	}
+	return copied, nil
+}
+
+func (r *externalRefResolver) document(location string) (interface{}, error) {
+	if doc, ok := r.docs[location]; ok {
+		return doc, nil
+	}
+	if len(r.loaded) >= maxExternalDocs {
+		return nil, errors.Errorf("refusing to load %v, swagger docs may refer to at most %v other documents",
+			location, maxExternalDocs)
+	}
+	if r.load == nil {
+		return nil, errors.Errorf("cannot load %v referred to by swagger doc", location)
+	}
+	docBytes, err := r.load(location)
+	if err != nil {
+		return nil, errors.Wrapf(err, "loading %v referred to by swagger doc", location)
+	}
+	jsn, err := toJSON(docBytes)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parsing %v referred to by swagger doc", location)
+	}
+	var doc interface{}
+	if err := json.Unmarshal(jsn, &doc); err != nil {
+		return nil, errors.Wrapf(err, "parsing %v referred to by swagger doc", location)
+	}
+	r.docs[location] = doc
+	r.loaded = append(r.loaded, docBytes)
+	return doc, nil
+}
+
+// names imported schemas after the last token of the pointer, or the document
+func (r *externalRefResolver) definitionName(target *url.URL, pointer string) string {
+	name := pointer[strings.LastIndex(pointer, "/")+1:]
+	if name == "" {
+		name = path.Base(target.Path)
+		name = strings.TrimSuffix(name, path.Ext(name))
+	}
+	name = invalidDefinitionChars.ReplaceAllString(name, "_")
+	if name == "" || name == "." {
+		name = "external"
+	}
+	unique := name
+	for i := 2; r.definitions[unique] != nil; i++ {
+		unique = fmt.Sprintf("%v_%v", name, i)
+	}
+	return unique
+}
@@ -0,0 +1,120 @@
+package swagger_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/solo-io/gloo-api/pkg/api/types/v1"
+	. "github.com/solo-io/gloo-function-discovery/internal/updater/swagger"
+	"github.com/solo-io/gloo-plugins/rest"
+)
+
+var _ = Describe("external refs", func() {
+	var (
+		srv  *httptest.Server
+		docs map[string]string
+	)
+	BeforeEach(func() {
+		docs = map[string]string{
+			"/api/swagger.json": multiFileDoc,
+			"/api/models.yaml":  modelsDoc,
+			"/common/address.json": `{"definitions": {"Address": {
+				"type": "object", "properties": {"city": {"type": "string"}}}}}`,
+			"/api/params.json": `{"limit": {"name": "limit", "in": "query", "type": "integer"},
+				"a": {"$ref": "#/b"}, "b": {"$ref": "#/a"}}`,
+		}
+		srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			doc, ok := docs[r.URL.Path]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			fmt.Fprint(w, doc)
+		}))
+	})
+	AfterEach(func() {
+		srv.Close()
+	})
+	upstream := func(path string) *v1.Upstream {
+		return &v1.Upstream{
+			Name: "multi-file",
+			Metadata: &v1.Metadata{Annotations: map[string]string{
+				AnnotationKeySwaggerURL: srv.URL + path,
+			}},
+		}
+	}
+
+	It("resolves refs relative to the swagger url", func() {
+		funcs, err := getFuncs(upstream("/api/swagger.json"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(funcs).To(HaveLen(2))
+		byName := make(map[string]*rest.Template)
+		for _, fn := range funcs {
+			tmpl, err := rest.DecodeFunctionSpec(fn.Spec)
+			Expect(err).NotTo(HaveOccurred())
+			byName[fn.Name] = tmpl
+		}
+		Expect(byName["listPets"].Path).To(Equal("/pets?limit={{limit}}"))
+		// the cycle back to Pet is not expanded
+		Expect(*byName["addPet"].Body).To(Equal(`{"name": "{{ default(name, "") }}",` +
+			`"owner": {"address": {"city": "{{ default(owner.address.city, "") }}"},"pet": null}}`))
+	})
+	It("fails on ref loops", func() {
+		docs["/api/swagger.json"] = strings.Replace(multiFileDoc, "params.json#/limit", "params.json#/a", 1)
+		_, err := getFuncs(upstream("/api/swagger.json"))
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("ref loop"))
+	})
+	It("loads a bounded number of documents", func() {
+		for i := 0; i < 30; i++ {
+			docs["/chain/"+strconv.Itoa(i)+".json"] = fmt.Sprintf(`{"type": "object", "properties": {"next": {"$ref": "%v.json"}}}`, i+1)
+		}
+		docs["/chain/swagger.json"] = `{"swagger": "2.0", "paths": {"/": {"post": {"operationId": "chain",
+			"parameters": [{"name": "body", "in": "body", "schema": {"$ref": "0.json"}}]}}}}`
+		_, err := getFuncs(upstream("/chain/swagger.json"))
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("at most"))
+	})
+})
+
+const multiFileDoc = `{
+  "swagger": "2.0",
+  "consumes": ["application/json"],
+  "paths": {
+    "/pets": {
+      "get": {
+        "operationId": "listPets",
+        "parameters": [{"$ref": "params.json#/limit"}],
+        "responses": {"200": {"description": "pets"}}
+      },
+      "post": {
+        "operationId": "addPet",
+        "parameters": [{"name": "pet", "in": "body", "schema": {"$ref": "models.yaml#/Pet"}}],
+        "responses": {"200": {"description": "added"}}
+      }
+    }
+  }
+}`
+
+const modelsDoc = `
+Pet:
+  type: object
+  properties:
+    name:
+      type: string
+    owner:
+      $ref: '#/Owner'
+Owner:
+  type: object
+  properties:
+    address:
+      $ref: '/common/address.json#/definitions/Address'
+    pet:
+      $ref: '#/Pet'
+`
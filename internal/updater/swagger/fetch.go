@@ -0,0 +1,217 @@
+package swagger
+
+import (
+	"crypto/tls"
+	"io/ioutil"
+	"net/http"
+	neturl "net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-openapi/spec"
+	"github.com/go-openapi/swag"
+	"github.com/pkg/errors"
+
+	"github.com/solo-io/gloo-api/pkg/api/types/v1"
+	"github.com/solo-io/gloo/pkg/secretwatcher"
+)
+
+const (
+	// ref of a secret with credentials for the swagger doc endpoint
+	AnnotationKeySwaggerAuthSecretRef = "gloo.solo.io/swagger_auth_secret_ref"
+	// set to "true" to skip verifying the certificate of an https swagger url
+	AnnotationKeySwaggerInsecureSkipVerify = "gloo.solo.io/swagger_insecure_skip_verify"
+
+	// keys of the auth secret. username and password are sent with basic auth,
+	// token as a bearer token, and api_key in the api_key_header header
+	SecretKeyUsername     = "username"
+	SecretKeyPassword     = "password"
+	SecretKeyToken        = "token"
+	SecretKeyAPIKey       = "api_key"
+	SecretKeyAPIKeyHeader = "api_key_header"
+
+	defaultAPIKeyHeader = "X-API-Key"
+	fetchTimeout        = 10 * time.Second
+)
+
+// Auth holds credentials for a swagger doc endpoint
+type Auth struct {
+	Username     string
+	Password     string
+	Token        string
+	APIKey       string
+	APIKeyHeader string
+}
+
+// AuthFromSecret reads the credentials referenced by the upstream's auth annotation.
+// it returns nil if the upstream has no auth annotation
+func AuthFromSecret(us *v1.Upstream, secrets secretwatcher.SecretMap) (*Auth, error) {
+	ref := AuthSecretRef(us)
+	if ref == "" {
+		return nil, nil
+	}
+	secret, ok := secrets[ref]
+	if !ok {
+		return nil, errors.Errorf("swagger auth secret %v not found", ref)
+	}
+	auth := &Auth{
+		Username:     secret[SecretKeyUsername],
+		Password:     secret[SecretKeyPassword],
+		Token:        secret[SecretKeyToken],
+		APIKey:       secret[SecretKeyAPIKey],
+		APIKeyHeader: secret[SecretKeyAPIKeyHeader],
+	}
+	if auth.Username == "" && auth.Token == "" && auth.APIKey == "" {
+		return nil, errors.Errorf("swagger auth secret %v must contain one of %v, %v or %v",
+			ref, SecretKeyUsername, SecretKeyToken, SecretKeyAPIKey)
+	}
+	return auth, nil
+}
+
+func AuthSecretRef(us *v1.Upstream) string {
+	if us.Metadata == nil {
+		return ""
+	}
+	return us.Metadata.Annotations[AnnotationKeySwaggerAuthSecretRef]
+}
+
+func (a *Auth) apply(req *http.Request) {
+	switch {
+	case a.Username != "":
+		req.SetBasicAuth(a.Username, a.Password)
+	case a.Token != "":
+		req.Header.Set("Authorization", "Bearer "+a.Token)
+	case a.APIKey != "":
+		header := a.APIKeyHeader
+		if header == "" {
+			header = defaultAPIKeyHeader
+		}
+		req.Header.Set(header, a.APIKey)
+	}
+}
+
+// FetchOptions configure the request for a swagger doc
+type FetchOptions struct {
+	Headers            map[string]string
+	Auth               *Auth
+	InsecureSkipVerify bool
+}
+
+// refLoader loads the documents the doc at root refers to. headers and credentials
+// are only sent to the host of the root doc, and only docs that are files themselves
+// may refer to files
+func refLoader(root string, opts FetchOptions) docLoader {
+	return func(location string) ([]byte, error) {
+		if !isHTTP(location) {
+			if root == "" || isHTTP(root) {
+				return nil, errors.Errorf("only swagger docs loaded from files may refer to files")
+			}
+			return swag.LoadFromFileOrHTTP(location)
+		}
+		refOpts := FetchOptions{InsecureSkipVerify: opts.InsecureSkipVerify}
+		if sameHost(root, location) {
+			refOpts = opts
+		}
+		res, err := fetch(location, refOpts, nil)
+		if err != nil {
+			return nil, err
+		}
+		return res.body, nil
+	}
+}
+
+func isHTTP(location string) bool {
+	return strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://")
+}
+
+func sameHost(a, b string) bool {
+	aURL, err := neturl.Parse(a)
+	if err != nil {
+		return false
+	}
+	bURL, err := neturl.Parse(b)
+	if err != nil {
+		return false
+	}
+	return aURL.Scheme == bURL.Scheme && aURL.Host == bURL.Host
+}
+
+type fetchResult struct {
+	body         []byte
+	etag         string
+	lastModified string
+	// the cached doc is still current
+	notModified bool
+}
+
+// fetch gets the doc, conditionally if a cached copy is given
+func fetch(url string, opts FetchOptions, cached *cachedDoc) (*fetchResult, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid url for request")
+	}
+	for name, value := range opts.Headers {
+		req.Header.Set(name, value)
+	}
+	if opts.Auth != nil {
+		opts.Auth.apply(req)
+	}
+	if cached != nil {
+		if cached.etag != "" {
+			req.Header.Set("If-None-Match", cached.etag)
+		}
+		if cached.lastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.lastModified)
+		}
+	}
+	client := &http.Client{Timeout: fetchTimeout}
+	if opts.InsecureSkipVerify {
+		client.Transport = &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		}
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "GET %v", url)
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotModified && cached != nil {
+		return &fetchResult{notModified: true}, nil
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("GET %v returned %v", url, res.Status)
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading swagger doc from %v", url)
+	}
+	return &fetchResult{
+		body:         body,
+		etag:         res.Header.Get("ETag"),
+		lastModified: res.Header.Get("Last-Modified"),
+	}, nil
+}
+
+// retrieves the doc for the upstream's swagger url. http urls are fetched with
+// the upstream's credentials, other urls are loaded as files
+func retrieveSwaggerDoc(us *v1.Upstream, url string, secrets secretwatcher.SecretMap, sources docSources) (*spec.Swagger, string, error) {
+	if !isHTTP(url) {
+		docBytes, err := swag.LoadFromFileOrHTTP(url)
+		if err != nil {
+			return nil, "", errors.Wrap(err, "loading swagger doc from url")
+		}
+		return loadSwaggerDoc(docBytes, url, refLoader(url, FetchOptions{}))
+	}
+	auth, err := AuthFromSecret(us, secrets)
+	if err != nil {
+		return nil, "", err
+	}
+	insecure, _ := strconv.ParseBool(us.Metadata.Annotations[AnnotationKeySwaggerInsecureSkipVerify])
+	return sources.docs.Get(url, FetchOptions{
+		Headers:            sources.fetch.Headers,
+		Auth:               auth,
+		InsecureSkipVerify: insecure || sources.fetch.InsecureSkipVerify,
+	})
+}
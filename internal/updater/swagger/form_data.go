@@ -0,0 +1,83 @@
+package swagger
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/go-openapi/spec"
+	"github.com/pkg/errors"
+)
+
+// fixed so that generated functions are idempotent
+const multipartBoundary = "gloo-function-discovery-boundary"
+
+// formContentType picks the form encoding the operation consumes for its formData
+// parameters. urlencoded is preferred, multipart is used when it is the only form
+// encoding consumed, or for file parameters, which can't be urlencoded
+func formContentType(consumes []string, formParams []spec.Parameter) (string, error) {
+	// operations that don't declare content types accept either
+	urlEncoded, multipart := len(consumes) == 0, len(consumes) == 0
+	for _, contentType := range consumes {
+		switch mediaType(contentType) {
+		case contentTypeFormURLEncode:
+			urlEncoded = true
+		case contentTypeMultipartForm:
+			multipart = true
+		}
+	}
+	for _, param := range formParams {
+		if param.Type != "file" {
+			continue
+		}
+		if !multipart {
+			return "", errors.Errorf("file parameter %v requires %v; available: %v", param.Name, contentTypeMultipartForm, consumes)
+		}
+		return contentTypeMultipartForm, nil
+	}
+	switch {
+	case urlEncoded:
+		return contentTypeFormURLEncode, nil
+	case multipart:
+		return contentTypeMultipartForm, nil
+	}
+	return "", errors.Errorf("form parameters require one of %v; available: %v",
+		[]string{contentTypeFormURLEncode, contentTypeMultipartForm}, consumes)
+}
+
+// getFormBodyTemplate returns the body template and content type header
+// for the given formData parameters
+func getFormBodyTemplate(consumes []string, formParams []spec.Parameter) (string, string, error) {
+	contentType, err := formContentType(consumes, formParams)
+	if err != nil {
+		return "", "", err
+	}
+	if contentType == contentTypeMultipartForm {
+		return getMultipartBodyTemplate(formParams), contentTypeMultipartForm + "; boundary=" + multipartBoundary, nil
+	}
+	return getURLEncodedBodyTemplate(formParams), contentTypeFormURLEncode, nil
+}
+
+// the values are escaped when the template is rendered, as they may contain & or =
+func getURLEncodedBodyTemplate(formParams []spec.Parameter) string {
+	var fields []string
+	for _, param := range formParams {
+		fields = append(fields, fmt.Sprintf("%v={{ urlencode(%v) }}", url.QueryEscape(param.Name), param.Name))
+	}
+	return strings.Join(fields, "&")
+}
+
+func getMultipartBodyTemplate(formParams []spec.Parameter) string {
+	var body string
+	for _, param := range formParams {
+		disposition := fmt.Sprintf(`form-data; name="%v"`, param.Name)
+		if param.Type == "file" {
+			disposition += fmt.Sprintf(`; filename="%v"`, param.Name)
+		}
+		body += "--" + multipartBoundary + "\r\n"
+		body += "Content-Disposition: " + disposition + "\r\n\r\n"
+		body += fmt.Sprintf("{{%v}}", param.Name) + "\r\n"
+	}
+	body += "--" + multipartBoundary + "--\r\n"
+	return body
+}
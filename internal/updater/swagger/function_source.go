@@ -0,0 +1,129 @@
+package swagger
+
+import (
+	"sync"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/solo-io/gloo-api/pkg/api/types/v1"
+	"github.com/solo-io/gloo-function-discovery/pkg/functiontypes"
+	"github.com/solo-io/gloo/pkg/filewatcher"
+	"github.com/solo-io/gloo/pkg/secretwatcher"
+)
+
+const SourceName = "swagger"
+
+type functionSource struct {
+	docs  *DocCache
+	files func() filewatcher.Files
+	// applies to upstreams without a filter annotation
+	filter *OperationFilter
+	fetch  FetchOptions
+
+	// functions are only generated again when the doc changes
+	generated map[string]*generatedFuncs
+	m         sync.Mutex
+}
+
+type generatedFuncs struct {
+	docVersion        string
+	responseTemplates bool
+	filterKey         string
+	funcs             []*v1.Function
+}
+
+// NewFunctionSource creates a source that fetches docs through the cache, which may be nil.
+// files provides the docs stored in file storage, and may be nil. filter selects the
+// operations of upstreams without a filter annotation, nil includes every operation.
+// fetch holds the headers and tls settings docs are fetched with, auth is read from
+// the upstream's secret
+func NewFunctionSource(docs *DocCache, files func() filewatcher.Files, filter *OperationFilter, fetch FetchOptions) functiontypes.FunctionSource {
+	return &functionSource{
+		docs:      docs,
+		files:     files,
+		filter:    filter,
+		fetch:     fetch,
+		generated: make(map[string]*generatedFuncs),
+	}
+}
+
+func (s *functionSource) Name() string {
+	return SourceName
+}
+
+func (s *functionSource) Matches(us *v1.Upstream) bool {
+	return IsSwagger(us)
+}
+
+func (s *functionSource) SecretRefs(us *v1.Upstream) []string {
+	if ref := AuthSecretRef(us); ref != "" {
+		return []string{ref}
+	}
+	return nil
+}
+
+func (s *functionSource) FileRefs(us *v1.Upstream) []string {
+	if ref := SwaggerFileRef(us); ref != "" {
+		return []string{ref}
+	}
+	return nil
+}
+
+func (s *functionSource) GetFuncs(us *v1.Upstream, secrets secretwatcher.SecretMap) ([]*v1.Function, error) {
+	var files filewatcher.Files
+	if s.files != nil {
+		files = s.files()
+	}
+	swaggerSpec, version, err := getSwaggerSpecForUpsrteam(us, secrets, docSources{
+		docs:  s.docs,
+		files: files,
+		fetch: s.fetch,
+	})
+	if err != nil {
+		return nil, err
+	}
+	responseTemplates := responseTemplatesEnabled(us)
+	filter, err := operationFilterFor(us, s.filter)
+	if err != nil {
+		return nil, err
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+	cached, ok := s.generated[us.Name]
+	if !ok || cached.docVersion != version || cached.responseTemplates != responseTemplates || cached.filterKey != filter.key() {
+		cached = &generatedFuncs{
+			docVersion:        version,
+			responseTemplates: responseTemplates,
+			filterKey:         filter.key(),
+			funcs:             createFunctions(swaggerSpec, responseTemplates, filter),
+		}
+		s.generated[us.Name] = cached
+	}
+	// the caller owns the functions it gets
+	funcs := make([]*v1.Function, len(cached.funcs))
+	for i, fn := range cached.funcs {
+		funcs[i] = proto.Clone(fn).(*v1.Function)
+	}
+	return funcs, nil
+}
+
+// CollectGarbage forgets the functions generated for deleted upstreams, and the
+// docs no upstream refers to anymore
+func (s *functionSource) CollectGarbage(upstreams []*v1.Upstream) {
+	existing := make(map[string]bool)
+	var urls []string
+	for _, us := range upstreams {
+		existing[us.Name] = true
+		if us.Metadata != nil && us.Metadata.Annotations[AnnotationKeySwaggerURL] != "" {
+			urls = append(urls, us.Metadata.Annotations[AnnotationKeySwaggerURL])
+		}
+	}
+	s.docs.CollectGarbage(urls)
+	s.m.Lock()
+	defer s.m.Unlock()
+	for name := range s.generated {
+		if !existing[name] {
+			delete(s.generated, name)
+		}
+	}
+}
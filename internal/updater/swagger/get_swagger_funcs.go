@@ -1,8 +1,8 @@
 package swagger
 
 import (
+	"encoding/json"
 	"fmt"
-	"sort"
 	"strings"
 
 	"github.com/go-openapi/loads"
@@ -12,37 +12,37 @@ import (
 
 	"github.com/solo-io/gloo-api/pkg/api/types/v1"
 	"github.com/solo-io/gloo-plugins/rest"
+	"github.com/solo-io/gloo/pkg/filewatcher"
 	"github.com/solo-io/gloo/pkg/log"
+	"github.com/solo-io/gloo/pkg/secretwatcher"
 )
 
-func GetFuncs(us *v1.Upstream) ([]*v1.Function, error) {
-	swaggerSpec, err := getSwaggerSpecForUpsrteam(us)
-	if err != nil {
-		return nil, err
-	}
-	var consumesJson bool
-	for _, contentType := range swaggerSpec.Consumes {
-		if contentType == "application/json" {
-			consumesJson = true
-			break
-		}
-	}
-	if !consumesJson {
-		return nil, errors.Errorf("swagger function discovery uses content type application/json; "+
-			"available: %v", swaggerSpec.Consumes)
-	}
-	// TODO: when response transformation is done, look at produces as well
+func createFunctions(swaggerSpec *spec.Swagger, responseTemplates bool, filter *OperationFilter) []*v1.Function {
 	var funcs []*v1.Function
 	for functionPath, pathItem := range swaggerSpec.Paths.Paths {
-		funcs = append(funcs, createFunctionsForPath(swaggerSpec.BasePath, functionPath, pathItem.PathItemProps, swaggerSpec.Definitions)...)
+		funcs = append(funcs, createFunctionsForPath(swaggerSpec, functionPath, pathItem.PathItemProps, responseTemplates, filter)...)
 	}
-	return funcs, nil
+	return funcs
 }
 
-func createFunctionsForPath(basePath, functionPath string, path spec.PathItemProps, definitions spec.Definitions) []*v1.Function {
+func createFunctionsForPath(swaggerSpec *spec.Swagger, functionPath string, path spec.PathItemProps, responseTemplates bool, filter *OperationFilter) []*v1.Function {
 	var pathFunctions []*v1.Function
 	appendFunction := func(method string, operation *spec.Operation) {
-		pathFunctions = append(pathFunctions, createFunctionForOpertaion(method, basePath, functionPath, operation.OperationProps, definitions))
+		if !filter.Includes(method, functionPath, operation.OperationProps) {
+			log.Debugf("%v %v excluded by operation filter", method, functionPath)
+			return
+		}
+		fn, err := createFunctionForOpertaion(method, swaggerSpec, functionPath, operation.OperationProps)
+		if err != nil {
+			log.Warnf("skipping %v %v: %v", method, functionPath, err)
+			return
+		}
+		if responseTemplates {
+			if tmpl := getResponseTemplate(operation.OperationProps, producesFor(swaggerSpec, operation.OperationProps), swaggerSpec.Definitions); tmpl != nil {
+				addResponseTemplate(fn, tmpl)
+			}
+		}
+		pathFunctions = append(pathFunctions, fn)
 	}
 	if path.Get != nil {
 		appendFunction("GET", path.Get)
@@ -68,11 +68,11 @@ func createFunctionsForPath(basePath, functionPath string, path spec.PathItemPro
 	return pathFunctions
 }
 
-func createFunctionForOpertaion(method string, basePath, functionPath string, operation spec.OperationProps, definitions spec.Definitions) *v1.Function {
+func createFunctionForOpertaion(method string, swaggerSpec *spec.Swagger, functionPath string, operation spec.OperationProps) (*v1.Function, error) {
 	var queryParams, headerParams []string
-	//bodyParams := make(map[string]spec.SchemaProps)
-	var body string
-	for _, param := range operation.Parameters {
+	var formParams []spec.Parameter
+	var bodyParam *spec.Parameter
+	for i, param := range operation.Parameters {
 		// sort parameters by the template they will go into
 		switch param.In {
 		case "query":
@@ -82,26 +82,56 @@ func createFunctionForOpertaion(method string, basePath, functionPath string, op
 		case "path":
 			// nothing to do here, we already get the template
 		case "formData":
-			log.Warnf("form data params not currently supported; ignoring")
+			formParams = append(formParams, param)
 		case "body":
-			body = getBodyTemplate("", definitions[param.Name].SchemaProps, definitions)
-			//bodyParams[param.Name] = param.Schema.SchemaProps
+			bodyParam = &operation.Parameters[i]
 		}
 	}
 
-	path := swaggerPathToJinjaTemplate(basePath + functionPath)
-	if len(queryParams) > 0 {
-		path += "?" + strings.Join(queryParams, "&")
+	// operation level consumes and produces override the document's
+	consumes := swaggerSpec.Consumes
+	if len(operation.Consumes) > 0 {
+		consumes = operation.Consumes
 	}
+	produces := producesFor(swaggerSpec, operation)
 
 	headersTemplate := map[string]string{":method": method}
-	if body != "" {
-		headersTemplate["Content-Type"] = "application/json"
+	var body string
+	switch {
+	case len(formParams) > 0:
+		var (
+			contentType string
+			err         error
+		)
+		body, contentType, err = getFormBodyTemplate(consumes, formParams)
+		if err != nil {
+			return nil, err
+		}
+		headersTemplate["Content-Type"] = contentType
+	case bodyParam != nil:
+		contentType, ok := negotiateContentType(consumes)
+		if !ok {
+			return nil, errors.Errorf("swagger function discovery generates json bodies; available: %v", consumes)
+		}
+		body = getBodyTemplate(bodyParam.Name, bodyParam.Schema, swaggerSpec.Definitions)
+		headersTemplate["Content-Type"] = contentType
+	}
+	if len(produces) > 0 {
+		if accept, ok := negotiateContentType(produces); ok {
+			headersTemplate["Accept"] = accept
+		} else {
+			headersTemplate["Accept"] = produces[0]
+		}
 	}
 	for _, name := range headerParams {
 		headersTemplate[name] = fmt.Sprintf("{{%v}}", name)
 	}
 
+	path := swaggerPathToJinjaTemplate(swaggerSpec.BasePath + functionPath)
+	if len(queryParams) > 0 {
+		path += "?" + strings.Join(queryParams, "&")
+	}
+
 	fnName := operation.ID
 	if fnName == "" {
 		fnName = strings.ToLower(method) + strings.Replace(functionPath, "/", ".", -1)
@@ -114,53 +144,14 @@ func createFunctionForOpertaion(method string, basePath, functionPath string, op
 			Header: headersTemplate,
 			Body:   &body,
 		}),
-	}
-}
-
-func getBodyTemplate(parent string, schema spec.SchemaProps, definitions spec.Definitions) string {
-	bodyTemplate := "{"
-	var fields []string
-	for key, prop := range schema.Properties {
-		var defaultValue string
-		if prop.Default != nil {
-			defaultValue = fmt.Sprintf("%v", prop.Default)
-		}
-		def := getDefinitionFor(prop.Ref, definitions)
-		defaultValue = fmt.Sprintf("\"%v\"", defaultValue)
-		paramName := "%v"
-		if parent != "" {
-			paramName = parent + ".%v"
-		}
-		switch {
-		case def != nil:
-			if def.Type.Contains("string") {
-				fields = append(fields, fmt.Sprintf(`"%v": "{{ default(`+paramName+`, %v)}}"`, key, getBodyTemplate(parent+"."+key, def.SchemaProps, definitions), defaultValue))
-			} else {
-				fields = append(fields, fmt.Sprintf(`"%v": {{ default(`+paramName+`, %v) }}`, key, getBodyTemplate(parent+"."+key, def.SchemaProps, definitions), defaultValue))
-			}
-		case prop.Type.Contains("string"):
-			// string needs escaping
-			fields = append(fields, fmt.Sprintf(`"%v": "{{ default(`+paramName+`, %v)}}"`, key, key, defaultValue))
-		default:
-			fields = append(fields, fmt.Sprintf(`"%v": {{ default(`+paramName+`, %v) }}`, key, key, defaultValue))
-		}
-	}
-	// idempotency
-	sort.SliceStable(fields, func(i, j int) bool {
-		return fields[i] < fields[j]
-	})
-	bodyTemplate += strings.Join(fields, ",")
-	bodyTemplate += "}"
-	return bodyTemplate
+	}, nil
 }
 
-func getDefinitionFor(ref spec.Ref, definitions spec.Definitions) *spec.Schema {
-	refName := strings.TrimPrefix(ref.String(), "#/definitions/")
-	schema, ok := definitions[refName]
-	if !ok {
-		return nil
+func producesFor(swaggerSpec *spec.Swagger, operation spec.OperationProps) []string {
+	if len(operation.Produces) > 0 {
+		return operation.Produces
 	}
-	return &schema
+	return swaggerSpec.Produces
 }
 
 func swaggerPathToJinjaTemplate(path string) string {
@@ -169,69 +160,126 @@ func swaggerPathToJinjaTemplate(path string) string {
 	return path
 }
 
-func getSwaggerSpecForUpsrteam(us *v1.Upstream) (*spec.Swagger, error) {
+// where the docs of upstreams are loaded from
+type docSources struct {
+	// may be nil
+	docs  *DocCache
+	files filewatcher.Files
+	// headers and tls settings for fetching docs, combined with the auth of the upstream
+	fetch FetchOptions
+}
+
+// returns the spec and a version that changes with the contents of the doc
+func getSwaggerSpecForUpsrteam(us *v1.Upstream, secrets secretwatcher.SecretMap, sources docSources) (*spec.Swagger, string, error) {
 	annotations, err := getSwaggerAnnotations(us)
 	if err != nil {
-		return nil, errors.Wrapf(err, "invalid or missing swagger annotations on %v", us.Name)
+		return nil, "", errors.Wrapf(err, "invalid or missing swagger annotations on %v", us.Name)
 	}
 	switch {
 	case annotations.SwaggerURL != "":
-		return RetrieveSwaggerDocFromUrl(annotations.SwaggerURL)
+		return retrieveSwaggerDoc(us, annotations.SwaggerURL, secrets, sources)
 	case annotations.InlineSwaggerDoc != "":
-		return parseSwaggerDoc([]byte(annotations.InlineSwaggerDoc))
+		return loadSwaggerDoc([]byte(annotations.InlineSwaggerDoc), "", refLoader("", FetchOptions{}))
+	case annotations.SwaggerFileRef != "":
+		file, ok := sources.files[annotations.SwaggerFileRef]
+		if !ok {
+			return nil, "", errors.Errorf("swagger doc file %v not found", annotations.SwaggerFileRef)
+		}
+		// files are resolved like inline docs, they can only refer to remote documents
+		return loadSwaggerDoc(file.Contents, "", refLoader("", FetchOptions{}))
 	}
-	return nil, errors.Errorf("one of %v or %v must be specified on the swagger upstream annotations",
+	return nil, "", errors.Errorf("one of %v, %v or %v must be specified on the swagger upstream annotations",
 		AnnotationKeySwaggerDoc,
-		AnnotationKeySwaggerURL)
+		AnnotationKeySwaggerURL,
+		AnnotationKeySwaggerFileRef)
 }
 
 // TODO: discover & set this annotation key on upstreams by checking for user-provided & common swagger urls
 func getSwaggerAnnotations(us *v1.Upstream) (*Annotations, error) {
 	swaggerUrl, urlOk := us.Metadata.Annotations[AnnotationKeySwaggerURL]
 	swaggerDoc, docOk := us.Metadata.Annotations[AnnotationKeySwaggerDoc]
-	if !urlOk && !docOk {
-		return nil, errors.Errorf("one of %v or %v must be set in the annotation for a swagger upstream", AnnotationKeySwaggerURL, AnnotationKeySwaggerDoc)
+	fileRef, fileOk := us.Metadata.Annotations[AnnotationKeySwaggerFileRef]
+	if !urlOk && !docOk && !fileOk {
+		return nil, errors.Errorf("one of %v, %v or %v must be set in the annotation for a swagger upstream",
+			AnnotationKeySwaggerURL, AnnotationKeySwaggerDoc, AnnotationKeySwaggerFileRef)
 	}
 	return &Annotations{
 		SwaggerURL:       swaggerUrl,
 		InlineSwaggerDoc: swaggerDoc,
+		SwaggerFileRef:   fileRef,
 	}, nil
 }
 
 const (
 	AnnotationKeySwaggerURL = "gloo.solo.io/swagger_url"
 	AnnotationKeySwaggerDoc = "gloo.solo.io/swagger_doc"
+	// ref of a file in gloo file storage containing the swagger doc
+	AnnotationKeySwaggerFileRef = "gloo.solo.io/swagger_file_ref"
+	// set to "true" to add response templates to discovered functions
+	AnnotationKeyResponseTemplates = "gloo.solo.io/swagger_response_templates"
 )
 
 type Annotations struct {
 	SwaggerURL       string
 	InlineSwaggerDoc string
+	SwaggerFileRef   string
 }
 
 func IsSwagger(us *v1.Upstream) bool {
-	return us.Metadata.Annotations[AnnotationKeySwaggerURL] != "" || us.Metadata.Annotations[AnnotationKeySwaggerDoc] != ""
+	return us.Metadata.Annotations[AnnotationKeySwaggerURL] != "" ||
+		us.Metadata.Annotations[AnnotationKeySwaggerDoc] != "" ||
+		us.Metadata.Annotations[AnnotationKeySwaggerFileRef] != ""
+}
+
+func SwaggerFileRef(us *v1.Upstream) string {
+	if us.Metadata == nil {
+		return ""
+	}
+	return us.Metadata.Annotations[AnnotationKeySwaggerFileRef]
 }
 
-func RetrieveSwaggerDocFromUrl(url string) (*spec.Swagger, error) {
-	docBytes, err := swag.LoadFromFileOrHTTP(url)
+// loadSwaggerDoc parses the doc found at location, loading the documents its refs
+// point to with load. the version changes whenever the contents of the doc or the
+// documents it refers to do
+func loadSwaggerDoc(docBytes []byte, location string, load docLoader) (*spec.Swagger, string, error) {
+	jsn, err := toJSON(docBytes)
 	if err != nil {
-		return nil, errors.Wrap(err, "loading swagger doc from url")
+		return nil, "", err
 	}
-	return parseSwaggerDoc(docBytes)
+	jsn, external, err := resolveExternalRefs(jsn, location, load)
+	if err != nil {
+		return nil, "", errors.Wrap(err, "resolving external refs")
+	}
+	swaggerSpec, err := parseSwaggerJSON(jsn)
+	if err != nil {
+		return nil, "", err
+	}
+	return swaggerSpec, docVersion(append([][]byte{docBytes}, external...)...), nil
 }
 
-func parseSwaggerDoc(docBytes []byte) (*spec.Swagger, error) {
-	doc, err := loads.Analyzed(docBytes, "")
+func toJSON(docBytes []byte) ([]byte, error) {
+	if json.Valid(docBytes) {
+		return docBytes, nil
+	}
+	log.Warnf("parsing doc as json failed, falling back to yaml")
+	yamlDoc, err := swag.BytesToYAMLDoc(docBytes)
 	if err != nil {
-		log.Warnf("parsing doc as json failed, falling back to yaml")
-		jsn, err := swag.YAMLToJSON(docBytes)
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to convert yaml to json (after falling back to yaml parsing)")
-		}
-		doc, err = loads.Analyzed(jsn, "")
-		if err != nil {
-			return nil, errors.Wrap(err, "invalid swagger doc")
-		}
+		return nil, errors.Wrap(err, "failed to parse doc as yaml (after falling back to yaml parsing)")
+	}
+	jsn, err := swag.YAMLToJSON(yamlDoc)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to convert yaml to json (after falling back to yaml parsing)")
+	}
+	return jsn, nil
+}
+
+func parseSwaggerJSON(jsn []byte) (*spec.Swagger, error) {
+	if isOpenAPI3(jsn) {
+		return convertOpenAPI3(jsn)
+	}
+	doc, err := loads.Analyzed(jsn, "")
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid swagger doc")
 	}
 	return doc.Spec(), nil
 }
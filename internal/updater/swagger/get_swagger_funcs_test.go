@@ -7,15 +7,24 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"sort"
 	"strconv"
 	"strings"
 
 	"github.com/solo-io/gloo-api/pkg/api/types/v1"
 	. "github.com/solo-io/gloo-function-discovery/internal/updater/swagger"
+	"github.com/solo-io/gloo-function-discovery/pkg/functiontypes"
 	"github.com/solo-io/gloo-plugins/rest"
+	"github.com/solo-io/gloo-storage/dependencies"
 	"github.com/solo-io/gloo/pkg/coreplugins/service"
+	"github.com/solo-io/gloo/pkg/filewatcher"
 )
 
+// generates functions the way function discovery does
+func getFuncs(us *v1.Upstream) ([]*v1.Function, error) {
+	return NewFunctionSource(nil, nil, nil, FetchOptions{}).GetFuncs(us, nil)
+}
+
 var _ = Describe("GetSwaggerFuncs", func() {
 
 	// create a test swagger server
@@ -48,7 +57,7 @@ var _ = Describe("GetSwaggerFuncs", func() {
 				},
 			}),
 		}
-		funcs, err := GetFuncs(us)
+		funcs, err := getFuncs(us)
 		Expect(err).NotTo(HaveOccurred())
 		Expect(funcs).To(HaveLen(1))
 		str := ""
@@ -56,14 +65,456 @@ var _ = Describe("GetSwaggerFuncs", func() {
 			Name: "get.pets",
 			Spec: rest.EncodeFunctionSpec(rest.Template{
 				Path:   "/api/pets",
-				Header: map[string]string{":method": "GET"},
+				Header: map[string]string{":method": "GET", "Accept": "application/json"},
 				Body:   &str,
 			}),
 		}
 		Expect(funcs[0]).To(Equal(expectedFn))
 	})
+	It("returns funcs for an openapi 3 doc", func() {
+		us := &v1.Upstream{
+			Name: "something",
+			Type: service.UpstreamTypeService,
+			Metadata: &v1.Metadata{Annotations: map[string]string{
+				AnnotationKeySwaggerDoc: openAPI3Doc,
+			}},
+		}
+		funcs, err := getFuncs(us)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(funcs).To(HaveLen(1))
+		str := ""
+		expectedFn := &v1.Function{
+			Name: "listPets",
+			Spec: rest.EncodeFunctionSpec(rest.Template{
+				Path:   "/api/pets?limit={{limit}}",
+				Header: map[string]string{":method": "GET", "Accept": "application/json"},
+				Body:   &str,
+			}),
+		}
+		Expect(funcs[0]).To(Equal(expectedFn))
+	})
+	It("returns a json body template for an openapi 3 request body", func() {
+		us := &v1.Upstream{
+			Name: "something",
+			Type: service.UpstreamTypeService,
+			Metadata: &v1.Metadata{Annotations: map[string]string{
+				AnnotationKeySwaggerDoc: openAPI3RequestBodyDoc,
+			}},
+		}
+		funcs, err := getFuncs(us)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(funcs).To(HaveLen(1))
+		Expect(funcs[0].Name).To(Equal("addPet"))
+		addPet, err := rest.DecodeFunctionSpec(funcs[0].Spec)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(addPet.Header).To(HaveKeyWithValue(":method", "POST"))
+		Expect(addPet.Header).To(HaveKeyWithValue("Content-Type", "application/json"))
+		Expect(*addPet.Body).To(Equal(`{"name": "{{ default(name, "") }}","tag": {"name": "{{ default(tag.name, "") }}"}}`))
+	})
+	It("returns funcs for an openapi 3.1 doc", func() {
+		us := &v1.Upstream{
+			Name: "something",
+			Type: service.UpstreamTypeService,
+			Metadata: &v1.Metadata{Annotations: map[string]string{
+				AnnotationKeySwaggerDoc: openAPI31Doc,
+			}},
+		}
+		funcs, err := getFuncs(us)
+		Expect(err).NotTo(HaveOccurred())
+		// the trace operation is skipped
+		Expect(funcs).To(HaveLen(1))
+		Expect(funcs[0].Name).To(Equal("addPet"))
+		addPet, err := rest.DecodeFunctionSpec(funcs[0].Spec)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(*addPet.Body).To(Equal(`{"age": {{ default(age, 0) }},"name": "{{ default(name, "") }}"}`))
+	})
+	It("returns form body templates for formData parameters", func() {
+		us := &v1.Upstream{
+			Name: "something",
+			Type: service.UpstreamTypeService,
+			Metadata: &v1.Metadata{Annotations: map[string]string{
+				AnnotationKeySwaggerDoc: formDataDoc,
+			}},
+		}
+		funcs, err := getFuncs(us)
+		Expect(err).NotTo(HaveOccurred())
+		// the avatar upload only consumes urlencoded forms, which can't hold its file
+		Expect(funcs).To(HaveLen(2))
+		sort.SliceStable(funcs, func(i, j int) bool {
+			return funcs[i].Name < funcs[j].Name
+		})
+
+		login, err := rest.DecodeFunctionSpec(funcs[0].Spec)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(login.Header).To(Equal(map[string]string{
+			":method":      "POST",
+			"Content-Type": "application/x-www-form-urlencoded",
+		}))
+		Expect(*login.Body).To(Equal("username={{ urlencode(username) }}&password={{ urlencode(password) }}"))
+
+		upload, err := rest.DecodeFunctionSpec(funcs[1].Spec)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(upload.Header).To(Equal(map[string]string{
+			":method":      "POST",
+			"Content-Type": "multipart/form-data; boundary=gloo-function-discovery-boundary",
+		}))
+		Expect(*upload.Body).To(Equal("--gloo-function-discovery-boundary\r\n" +
+			"Content-Disposition: form-data; name=\"file\"; filename=\"file\"\r\n\r\n" +
+			"{{file}}\r\n" +
+			"--gloo-function-discovery-boundary--\r\n"))
+	})
+	It("negotiates content types per operation", func() {
+		us := &v1.Upstream{
+			Name: "something",
+			Type: service.UpstreamTypeService,
+			Metadata: &v1.Metadata{Annotations: map[string]string{
+				AnnotationKeySwaggerDoc: contentTypesDoc,
+			}},
+		}
+		funcs, err := getFuncs(us)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(funcs).To(HaveLen(2))
+		sort.SliceStable(funcs, func(i, j int) bool {
+			return funcs[i].Name < funcs[j].Name
+		})
+
+		Expect(funcs[0].Name).To(Equal("createPet"))
+		createPet, err := rest.DecodeFunctionSpec(funcs[0].Spec)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(createPet.Header).To(Equal(map[string]string{
+			":method":      "POST",
+			"Content-Type": "application/json; charset=utf-8",
+			"Accept":       "application/xml",
+		}))
+
+		Expect(funcs[1].Name).To(Equal("deletePet"))
+		deletePet, err := rest.DecodeFunctionSpec(funcs[1].Spec)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(deletePet.Header).To(Equal(map[string]string{
+			":method": "DELETE",
+			"Accept":  "application/xml",
+		}))
+	})
+	It("adds response templates when enabled on the upstream", func() {
+		us := &v1.Upstream{
+			Name: "something",
+			Type: service.UpstreamTypeService,
+			Metadata: &v1.Metadata{Annotations: map[string]string{
+				AnnotationKeySwaggerDoc:        contentTypesDoc,
+				AnnotationKeyResponseTemplates: "true",
+			}},
+		}
+		funcs, err := getFuncs(us)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(funcs).To(HaveLen(2))
+		for _, fn := range funcs {
+			tmpl, err := DecodeResponseTemplate(fn)
+			Expect(err).NotTo(HaveOccurred())
+			// content types doc only produces xml
+			Expect(tmpl).To(BeNil())
+		}
+
+		us.Metadata.Annotations[AnnotationKeySwaggerDoc] = responseDoc
+		funcs, err = getFuncs(us)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(funcs).To(HaveLen(1))
+		tmpl, err := DecodeResponseTemplate(funcs[0])
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tmpl).To(Equal(&ResponseTemplate{
+			StatusCode:  200,
+			ContentType: "application/json",
+			SchemaRef:   "Pet",
+			Body:        `{"id": {{ default(id, 0) }},"name": "{{ default(name, "") }}"}`,
+		}))
+
+		// the rest plugin decodes the spec as it would without the response template
+		withTemplate, err := rest.DecodeFunctionSpec(funcs[0].Spec)
+		Expect(err).NotTo(HaveOccurred())
+		delete(us.Metadata.Annotations, AnnotationKeyResponseTemplates)
+		funcs, err = getFuncs(us)
+		Expect(err).NotTo(HaveOccurred())
+		withoutTemplate, err := rest.DecodeFunctionSpec(funcs[0].Spec)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(withTemplate).To(Equal(withoutTemplate))
+	})
+	It("returns funcs for a doc in file storage", func() {
+		us := &v1.Upstream{
+			Name: "something",
+			Type: service.UpstreamTypeService,
+			Metadata: &v1.Metadata{Annotations: map[string]string{
+				AnnotationKeySwaggerFileRef: "petstore.json",
+			}},
+		}
+		files := filewatcher.Files{}
+		source := NewFunctionSource(nil, func() filewatcher.Files { return files }, nil, FetchOptions{})
+		Expect(source.(functiontypes.FileConsumer).FileRefs(us)).To(Equal([]string{"petstore.json"}))
+
+		_, err := source.GetFuncs(us, nil)
+		Expect(err).To(HaveOccurred())
+
+		files["petstore.json"] = &dependencies.File{Ref: "petstore.json", Contents: []byte(swaggerDoc)}
+		funcs, err := source.GetFuncs(us, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(funcs).To(HaveLen(1))
+		Expect(funcs[0].Name).To(Equal("get.pets"))
+	})
 })
 
+const responseDoc = `{
+  "swagger": "2.0",
+  "info": {
+    "version": "1.0.0",
+    "title": "Responses"
+  },
+  "produces": [
+    "application/json"
+  ],
+  "paths": {
+    "/pets/{id}": {
+      "get": {
+        "operationId": "getPet",
+        "parameters": [
+          {"name": "id", "in": "path", "type": "integer", "required": true}
+        ],
+        "responses": {
+          "404": {"description": "not found", "schema": {"type": "string"}},
+          "200": {"description": "the pet", "schema": {"$ref": "#/definitions/Pet"}}
+        }
+      }
+    }
+  },
+  "definitions": {
+    "Pet": {
+      "type": "object",
+      "properties": {
+        "id": {"type": "integer"},
+        "name": {"type": "string"}
+      }
+    }
+  }
+}`
+
+const contentTypesDoc = `{
+  "swagger": "2.0",
+  "info": {
+    "version": "1.0.0",
+    "title": "Content Types"
+  },
+  "consumes": [
+    "application/xml"
+  ],
+  "produces": [
+    "application/xml"
+  ],
+  "paths": {
+    "/pets": {
+      "post": {
+        "operationId": "createPet",
+        "consumes": [
+          "application/json; charset=utf-8"
+        ],
+        "parameters": [
+          {"name": "pet", "in": "body", "schema": {"type": "object", "properties": {"name": {"type": "string"}}}}
+        ],
+        "responses": {"201": {"description": "created"}}
+      },
+      "put": {
+        "operationId": "replacePet",
+        "parameters": [
+          {"name": "pet", "in": "body", "schema": {"type": "object", "properties": {"name": {"type": "string"}}}}
+        ],
+        "responses": {"200": {"description": "replaced"}}
+      }
+    },
+    "/pets/{id}": {
+      "delete": {
+        "operationId": "deletePet",
+        "parameters": [
+          {"name": "id", "in": "path", "type": "integer", "required": true}
+        ],
+        "responses": {"204": {"description": "deleted"}}
+      }
+    }
+  }
+}`
+
+const formDataDoc = `{
+  "swagger": "2.0",
+  "info": {
+    "version": "1.0.0",
+    "title": "Forms"
+  },
+  "consumes": [
+    "application/x-www-form-urlencoded"
+  ],
+  "paths": {
+    "/login": {
+      "post": {
+        "operationId": "login",
+        "parameters": [
+          {"name": "username", "in": "formData", "type": "string"},
+          {"name": "password", "in": "formData", "type": "string"}
+        ],
+        "responses": {"204": {"description": "logged in"}}
+      }
+    },
+    "/avatar": {
+      "post": {
+        "operationId": "uploadAvatar",
+        "parameters": [
+          {"name": "avatar", "in": "formData", "type": "file"}
+        ],
+        "responses": {"204": {"description": "uploaded"}}
+      }
+    },
+    "/upload": {
+      "post": {
+        "operationId": "upload",
+        "consumes": [
+          "multipart/form-data"
+        ],
+        "parameters": [
+          {"name": "file", "in": "formData", "type": "file"}
+        ],
+        "responses": {"204": {"description": "uploaded"}}
+      }
+    }
+  }
+}`
+
+const openAPI3Doc = `{
+  "openapi": "3.0.0",
+  "info": {
+    "version": "1.0.0",
+    "title": "Swagger Petstore"
+  },
+  "servers": [
+    {
+      "url": "http://{host}/api/",
+      "variables": {
+        "host": {
+          "default": "petstore.swagger.io"
+        }
+      }
+    }
+  ],
+  "paths": {
+    "/pets": {
+      "get": {
+        "operationId": "listPets",
+        "parameters": [
+          {
+            "$ref": "#/components/parameters/limit"
+          }
+        ],
+        "responses": {
+          "200": {
+            "description": "A list of pets.",
+            "content": {
+              "application/json": {
+                "schema": {
+                  "type": "array",
+                  "items": {
+                    "$ref": "#/components/schemas/Pet"
+                  }
+                }
+              }
+            }
+          }
+        }
+      }
+    }
+  },
+  "components": {
+    "parameters": {
+      "limit": {
+        "name": "limit",
+        "in": "query",
+        "schema": {
+          "type": "integer"
+        }
+      }
+    },
+    "schemas": {
+      "Pet": {
+        "type": "object",
+        "required": [
+          "id",
+          "name"
+        ],
+        "properties": {
+          "id": {
+            "type": "integer",
+            "format": "int64"
+          },
+          "name": {
+            "type": "string"
+          }
+        }
+      }
+    }
+  }
+}`
+
+const openAPI3RequestBodyDoc = `{
+  "openapi": "3.0.3",
+  "paths": {
+    "/pets": {
+      "post": {
+        "operationId": "addPet",
+        "requestBody": {
+          "required": true,
+          "content": {
+            "application/json": {"schema": {"$ref": "#/components/schemas/NewPet"}}
+          }
+        },
+        "responses": {"201": {"description": "added"}}
+      }
+    }
+  },
+  "components": {
+    "schemas": {
+      "NewPet": {
+        "type": "object",
+        "properties": {
+          "name": {"type": "string"},
+          "tag": {"$ref": "#/components/schemas/Tag"}
+        }
+      },
+      "Tag": {"type": "object", "properties": {"name": {"type": "string"}}}
+    }
+  }
+}`
+
+const openAPI31Doc = `{
+  "openapi": "3.1.0",
+  "paths": {
+    "/pets": {
+      "post": {
+        "operationId": "addPet",
+        "requestBody": {
+          "content": {
+            "application/json": {
+              "schema": {
+                "type": "object",
+                "properties": {
+                  "name": {"type": ["string", "null"]},
+                  "age": {"type": "integer", "exclusiveMinimum": 0, "exclusiveMaximum": 100}
+                }
+              }
+            }
+          }
+        },
+        "responses": {"201": {"description": "added"}}
+      },
+      "trace": {
+        "operationId": "tracePets",
+        "responses": {"200": {"description": "traced"}}
+      }
+    }
+  }
+}`
+
 const swaggerDoc = `{
   "swagger": "2.0",
   "info": {
@@ -0,0 +1,443 @@
+package swagger
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-openapi/spec"
+	"github.com/pkg/errors"
+	"github.com/solo-io/gloo/pkg/log"
+)
+
+// OpenAPI 3.x documents are converted to the swagger 2.0 object model
+// so that function generation is shared between both spec versions
+
+const (
+	openAPI3SchemaRefPrefix      = "#/components/schemas/"
+	openAPI3ParameterRefPrefix   = "#/components/parameters/"
+	openAPI3RequestBodyRefPrefix = "#/components/requestBodies/"
+	openAPI3ResponseRefPrefix    = "#/components/responses/"
+	swaggerDefinitionRefPrefix   = "#/definitions/"
+	defaultOpenAPI3BodyParamName = "body"
+)
+
+type openAPI3Doc struct {
+	OpenAPI    string                      `json:"openapi"`
+	Servers    []openAPI3Server            `json:"servers"`
+	Paths      map[string]openAPI3PathItem `json:"paths"`
+	Components openAPI3Components          `json:"components"`
+}
+
+type openAPI3Server struct {
+	URL       string                            `json:"url"`
+	Variables map[string]openAPI3ServerVariable `json:"variables"`
+}
+
+type openAPI3ServerVariable struct {
+	Default string `json:"default"`
+}
+
+type openAPI3Components struct {
+	Schemas       map[string]spec.Schema         `json:"schemas"`
+	Parameters    map[string]openAPI3Parameter   `json:"parameters"`
+	RequestBodies map[string]openAPI3RequestBody `json:"requestBodies"`
+	Responses     map[string]openAPI3Response    `json:"responses"`
+}
+
+type openAPI3PathItem struct {
+	Parameters []openAPI3Parameter `json:"parameters"`
+	Get        *openAPI3Operation  `json:"get"`
+	Put        *openAPI3Operation  `json:"put"`
+	Post       *openAPI3Operation  `json:"post"`
+	Delete     *openAPI3Operation  `json:"delete"`
+	Options    *openAPI3Operation  `json:"options"`
+	Head       *openAPI3Operation  `json:"head"`
+	Patch      *openAPI3Operation  `json:"patch"`
+	// swagger 2.0 has no trace operations, they are skipped
+	Trace *openAPI3Operation `json:"trace"`
+}
+
+type openAPI3Operation struct {
+	OperationID string                      `json:"operationId"`
+	Summary     string                      `json:"summary"`
+	Description string                      `json:"description"`
+	Tags        []string                    `json:"tags"`
+	Deprecated  bool                        `json:"deprecated"`
+	Parameters  []openAPI3Parameter         `json:"parameters"`
+	RequestBody *openAPI3RequestBody        `json:"requestBody"`
+	Responses   map[string]openAPI3Response `json:"responses"`
+}
+
+type openAPI3Parameter struct {
+	Ref         string       `json:"$ref"`
+	Name        string       `json:"name"`
+	In          string       `json:"in"`
+	Description string       `json:"description"`
+	Required    bool         `json:"required"`
+	Schema      *spec.Schema `json:"schema"`
+}
+
+type openAPI3RequestBody struct {
+	Ref      string                       `json:"$ref"`
+	Required bool                         `json:"required"`
+	Content  map[string]openAPI3MediaType `json:"content"`
+}
+
+type openAPI3Response struct {
+	Ref         string                       `json:"$ref"`
+	Description string                       `json:"description"`
+	Content     map[string]openAPI3MediaType `json:"content"`
+}
+
+type openAPI3MediaType struct {
+	Schema *spec.Schema `json:"schema"`
+}
+
+// isOpenAPI3 checks the version field of a json document
+func isOpenAPI3(jsn []byte) bool {
+	var version struct {
+		OpenAPI string `json:"openapi"`
+	}
+	if err := json.Unmarshal(jsn, &version); err != nil {
+		return false
+	}
+	return strings.HasPrefix(version.OpenAPI, "3.")
+}
+
+// convertOpenAPI3 converts an OpenAPI 3.x json document to a swagger 2.0 spec
+func convertOpenAPI3(jsn []byte) (*spec.Swagger, error) {
+	// schemas are valid json schema in both versions, only their location differs
+	jsn = bytes.Replace(jsn, []byte(`"`+openAPI3SchemaRefPrefix), []byte(`"`+swaggerDefinitionRefPrefix), -1)
+	jsn, err := normalizeSchemaKeywords(jsn)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid openapi 3 doc")
+	}
+	var doc openAPI3Doc
+	if err := json.Unmarshal(jsn, &doc); err != nil {
+		return nil, errors.Wrap(err, "invalid openapi 3 doc")
+	}
+
+	basePath, err := doc.basePath()
+	if err != nil {
+		return nil, err
+	}
+
+	swaggerSpec := &spec.Swagger{
+		SwaggerProps: spec.SwaggerProps{
+			Swagger:     "2.0",
+			BasePath:    basePath,
+			Definitions: spec.Definitions(doc.Components.Schemas),
+			Paths:       &spec.Paths{Paths: make(map[string]spec.PathItem)},
+		},
+	}
+
+	for functionPath, pathItem := range doc.Paths {
+		swaggerPathItem := spec.PathItem{}
+		convertOperation := func(operation *openAPI3Operation) (*spec.Operation, error) {
+			if operation == nil {
+				return nil, nil
+			}
+			op, err := doc.convertOperation(pathItem.Parameters, operation)
+			if err != nil {
+				return nil, errors.Wrapf(err, "converting operation for path %v", functionPath)
+			}
+			return op, nil
+		}
+		if swaggerPathItem.Get, err = convertOperation(pathItem.Get); err != nil {
+			return nil, err
+		}
+		if swaggerPathItem.Put, err = convertOperation(pathItem.Put); err != nil {
+			return nil, err
+		}
+		if swaggerPathItem.Post, err = convertOperation(pathItem.Post); err != nil {
+			return nil, err
+		}
+		if swaggerPathItem.Delete, err = convertOperation(pathItem.Delete); err != nil {
+			return nil, err
+		}
+		if swaggerPathItem.Options, err = convertOperation(pathItem.Options); err != nil {
+			return nil, err
+		}
+		if swaggerPathItem.Head, err = convertOperation(pathItem.Head); err != nil {
+			return nil, err
+		}
+		if swaggerPathItem.Patch, err = convertOperation(pathItem.Patch); err != nil {
+			return nil, err
+		}
+		if pathItem.Trace != nil {
+			log.Warnf("skipping trace operation %v for path %v; trace operations are not supported", pathItem.Trace.OperationID, functionPath)
+		}
+		swaggerSpec.Paths.Paths[functionPath] = swaggerPathItem
+	}
+
+	// openapi 3 has no document-level consumes or produces,
+	// the content types are declared per operation
+	return swaggerSpec, nil
+}
+
+// normalizeSchemaKeywords rewrites the keywords of OpenAPI 3.1 schemas whose form
+// differs in the Draft 4 schemas of swagger 2.0: a numeric exclusiveMinimum or
+// exclusiveMaximum becomes the minimum or maximum, with the boolean flag set
+func normalizeSchemaKeywords(jsn []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(jsn))
+	// numbers are written back as they were
+	decoder.UseNumber()
+	var doc interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, err
+	}
+	var normalize func(value interface{})
+	normalize = func(value interface{}) {
+		switch value := value.(type) {
+		case map[string]interface{}:
+			for keyword, bound := range map[string]string{"exclusiveMinimum": "minimum", "exclusiveMaximum": "maximum"} {
+				if limit, ok := value[keyword].(json.Number); ok {
+					value[bound] = limit
+					value[keyword] = true
+				}
+			}
+			for _, child := range value {
+				normalize(child)
+			}
+		case []interface{}:
+			for _, child := range value {
+				normalize(child)
+			}
+		}
+	}
+	normalize(doc)
+	return json.Marshal(doc)
+}
+
+// the base path is the path of the first server url, with variables
+// replaced by their defaults
+func (doc *openAPI3Doc) basePath() (string, error) {
+	if len(doc.Servers) == 0 {
+		return "", nil
+	}
+	server := doc.Servers[0]
+	serverURL := server.URL
+	for name, variable := range server.Variables {
+		serverURL = strings.Replace(serverURL, "{"+name+"}", variable.Default, -1)
+	}
+	u, err := url.Parse(serverURL)
+	if err != nil {
+		return "", errors.Wrapf(err, "invalid server url %v", server.URL)
+	}
+	return strings.TrimSuffix(u.Path, "/"), nil
+}
+
+func (doc *openAPI3Doc) convertOperation(pathParams []openAPI3Parameter, operation *openAPI3Operation) (*spec.Operation, error) {
+	op := &spec.Operation{
+		OperationProps: spec.OperationProps{
+			ID:          operation.OperationID,
+			Summary:     operation.Summary,
+			Description: operation.Description,
+			Tags:        operation.Tags,
+			Deprecated:  operation.Deprecated,
+		},
+	}
+
+	// operation parameters override path parameters with the same name and location
+	params := make(map[string]openAPI3Parameter)
+	var order []string
+	for _, param := range append(append([]openAPI3Parameter{}, pathParams...), operation.Parameters...) {
+		resolved, err := doc.resolveParameter(param)
+		if err != nil {
+			return nil, err
+		}
+		key := resolved.In + "/" + resolved.Name
+		if _, ok := params[key]; !ok {
+			order = append(order, key)
+		}
+		params[key] = resolved
+	}
+	for _, key := range order {
+		param := params[key]
+		// cookie parameters have no swagger 2.0 equivalent
+		if param.In == "cookie" {
+			continue
+		}
+		op.Parameters = append(op.Parameters, convertParameter(param))
+	}
+
+	if operation.RequestBody != nil {
+		requestBody, err := doc.resolveRequestBody(*operation.RequestBody)
+		if err != nil {
+			return nil, err
+		}
+		op.Consumes = sortedContentTypes(requestBody.Content)
+		if len(op.Consumes) > 0 {
+			contentType := preferredContentType(op.Consumes)
+			schema := requestBody.Content[contentType].Schema
+			if schema == nil {
+				schema = &spec.Schema{}
+			}
+			if isFormContentType(contentType) {
+				op.Parameters = append(op.Parameters, doc.formDataParameters(*schema)...)
+			} else {
+				op.Parameters = append(op.Parameters, spec.Parameter{
+					ParamProps: spec.ParamProps{
+						Name:     defaultOpenAPI3BodyParamName,
+						In:       "body",
+						Required: requestBody.Required,
+						Schema:   schema,
+					},
+				})
+			}
+		}
+	}
+
+	if len(operation.Responses) > 0 {
+		op.Responses = &spec.Responses{
+			ResponsesProps: spec.ResponsesProps{
+				StatusCodeResponses: make(map[int]spec.Response),
+			},
+		}
+		produces := make(map[string]bool)
+		for code, response := range operation.Responses {
+			resolved, err := doc.resolveResponse(response)
+			if err != nil {
+				return nil, err
+			}
+			contentTypes := sortedContentTypes(resolved.Content)
+			swaggerResponse := spec.Response{
+				ResponseProps: spec.ResponseProps{Description: resolved.Description},
+			}
+			if len(contentTypes) > 0 {
+				swaggerResponse.Schema = resolved.Content[preferredContentType(contentTypes)].Schema
+			}
+			for _, contentType := range contentTypes {
+				produces[contentType] = true
+			}
+			if code == "default" {
+				op.Responses.Default = &swaggerResponse
+				continue
+			}
+			statusCode, err := strconv.Atoi(code)
+			if err != nil {
+				// ranges such as 2XX are not representable in swagger 2.0
+				continue
+			}
+			op.Responses.StatusCodeResponses[statusCode] = swaggerResponse
+		}
+		for contentType := range produces {
+			op.Produces = append(op.Produces, contentType)
+		}
+		sort.Strings(op.Produces)
+	}
+
+	return op, nil
+}
+
+// form request bodies are described by an object schema; each property
+// becomes a swagger 2.0 formData parameter
+func (doc *openAPI3Doc) formDataParameters(schema spec.Schema) []spec.Parameter {
+	if name := definitionName(schema.Ref); name != "" {
+		schema = doc.Components.Schemas[name]
+	}
+	var names []string
+	for name := range schema.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var params []spec.Parameter
+	for _, name := range names {
+		prop := schema.Properties[name]
+		param := spec.Parameter{
+			ParamProps: spec.ParamProps{
+				Name:        name,
+				In:          "formData",
+				Description: prop.Description,
+			},
+		}
+		for _, required := range schema.Required {
+			if required == name {
+				param.Required = true
+			}
+		}
+		switch {
+		case prop.Type.Contains("string") && (prop.Format == "binary" || prop.Format == "base64"):
+			param.Type = "file"
+		case len(prop.Type) > 0:
+			param.Type = prop.Type[0]
+		}
+		params = append(params, param)
+	}
+	return params
+}
+
+func convertParameter(param openAPI3Parameter) spec.Parameter {
+	swaggerParam := spec.Parameter{
+		ParamProps: spec.ParamProps{
+			Name:        param.Name,
+			In:          param.In,
+			Description: param.Description,
+			Required:    param.Required,
+		},
+	}
+	if param.Schema != nil {
+		if len(param.Schema.Type) > 0 {
+			swaggerParam.Type = param.Schema.Type[0]
+		}
+		swaggerParam.Format = param.Schema.Format
+		swaggerParam.Default = param.Schema.Default
+	}
+	return swaggerParam
+}
+
+func (doc *openAPI3Doc) resolveParameter(param openAPI3Parameter) (openAPI3Parameter, error) {
+	if param.Ref == "" {
+		return param, nil
+	}
+	resolved, ok := doc.Components.Parameters[strings.TrimPrefix(param.Ref, openAPI3ParameterRefPrefix)]
+	if !ok || resolved.Ref != "" {
+		return openAPI3Parameter{}, errors.Errorf("unresolvable parameter ref %v", param.Ref)
+	}
+	return resolved, nil
+}
+
+func (doc *openAPI3Doc) resolveRequestBody(requestBody openAPI3RequestBody) (openAPI3RequestBody, error) {
+	if requestBody.Ref == "" {
+		return requestBody, nil
+	}
+	resolved, ok := doc.Components.RequestBodies[strings.TrimPrefix(requestBody.Ref, openAPI3RequestBodyRefPrefix)]
+	if !ok || resolved.Ref != "" {
+		return openAPI3RequestBody{}, errors.Errorf("unresolvable request body ref %v", requestBody.Ref)
+	}
+	return resolved, nil
+}
+
+func (doc *openAPI3Doc) resolveResponse(response openAPI3Response) (openAPI3Response, error) {
+	if response.Ref == "" {
+		return response, nil
+	}
+	resolved, ok := doc.Components.Responses[strings.TrimPrefix(response.Ref, openAPI3ResponseRefPrefix)]
+	if !ok || resolved.Ref != "" {
+		return openAPI3Response{}, errors.Errorf("unresolvable response ref %v", response.Ref)
+	}
+	return resolved, nil
+}
+
+func sortedContentTypes(content map[string]openAPI3MediaType) []string {
+	var contentTypes []string
+	for contentType := range content {
+		contentTypes = append(contentTypes, contentType)
+	}
+	sort.Strings(contentTypes)
+	return contentTypes
+}
+
+// json is preferred when available, otherwise the first content type is used
+func preferredContentType(contentTypes []string) string {
+	for _, contentType := range contentTypes {
+		if contentType == contentTypeJSON {
+			return contentType
+		}
+	}
+	return contentTypes[0]
+}
@@ -0,0 +1,166 @@
+package swagger
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/go-openapi/spec"
+	"github.com/pkg/errors"
+
+	"github.com/solo-io/gloo-api/pkg/api/types/v1"
+)
+
+// AnnotationKeyOperationFilter holds an OperationFilter as json or yaml. it replaces
+// the global filter for the upstream
+const AnnotationKeyOperationFilter = "gloo.solo.io/swagger_operation_filter"
+
+// OperationFilter selects the operations of a swagger doc that become functions.
+// an operation is included if it matches every include rule that is set, and none
+// of the exclude rules
+type OperationFilter struct {
+	// operations with at least one of these tags
+	IncludeTags []string `json:"include_tags,omitempty"`
+	ExcludeTags []string `json:"exclude_tags,omitempty"`
+	// globs matched against the path of the operation, without the base path.
+	// * matches within a path segment, ** across segments
+	IncludePaths []string `json:"include_paths,omitempty"`
+	ExcludePaths []string `json:"exclude_paths,omitempty"`
+	// http methods, case insensitive
+	IncludeMethods []string `json:"include_methods,omitempty"`
+	ExcludeMethods []string `json:"exclude_methods,omitempty"`
+	// skip operations marked as deprecated
+	ExcludeDeprecated bool `json:"exclude_deprecated,omitempty"`
+
+	// the compiled path globs of a parsed filter
+	includePaths, excludePaths []*regexp.Regexp
+}
+
+// UnmarshalJSON parses the filter and compiles its path globs, so they are
+// compiled once rather than for every operation
+func (f *OperationFilter) UnmarshalJSON(data []byte) error {
+	type plain OperationFilter
+	if err := json.Unmarshal(data, (*plain)(f)); err != nil {
+		return err
+	}
+	f.includePaths = compileGlobs(f.IncludePaths)
+	f.excludePaths = compileGlobs(f.ExcludePaths)
+	return nil
+}
+
+// operationFilterFor returns the filter of the upstream, or the global filter if
+// the upstream has none. nil includes every operation
+func operationFilterFor(us *v1.Upstream, global *OperationFilter) (*OperationFilter, error) {
+	if us.Metadata == nil || us.Metadata.Annotations[AnnotationKeyOperationFilter] == "" {
+		return global, nil
+	}
+	var filter OperationFilter
+	if err := yaml.Unmarshal([]byte(us.Metadata.Annotations[AnnotationKeyOperationFilter]), &filter); err != nil {
+		return nil, errors.Wrapf(err, "invalid %v annotation on %v", AnnotationKeyOperationFilter, us.Name)
+	}
+	return &filter, nil
+}
+
+// Includes returns true if the operation becomes a function
+func (f *OperationFilter) Includes(method, functionPath string, operation spec.OperationProps) bool {
+	if f == nil {
+		return true
+	}
+	if f.ExcludeDeprecated && operation.Deprecated {
+		return false
+	}
+	if len(f.IncludeMethods) > 0 && !containsFold(f.IncludeMethods, method) {
+		return false
+	}
+	if containsFold(f.ExcludeMethods, method) {
+		return false
+	}
+	includePaths, excludePaths := f.includePaths, f.excludePaths
+	// not parsed, e.g. built in code
+	if includePaths == nil && excludePaths == nil {
+		includePaths, excludePaths = compileGlobs(f.IncludePaths), compileGlobs(f.ExcludePaths)
+	}
+	if len(includePaths) > 0 && !matchesAny(includePaths, functionPath) {
+		return false
+	}
+	if matchesAny(excludePaths, functionPath) {
+		return false
+	}
+	if len(f.IncludeTags) > 0 && !containsAny(f.IncludeTags, operation.Tags) {
+		return false
+	}
+	return !containsAny(f.ExcludeTags, operation.Tags)
+}
+
+// identifies the filter when caching the functions it selected
+func (f *OperationFilter) key() string {
+	if f == nil {
+		return ""
+	}
+	b, _ := json.Marshal(f)
+	return string(b)
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsAny(list, items []string) bool {
+	for _, item := range items {
+		for _, listItem := range list {
+			if item == listItem {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func compileGlobs(globs []string) []*regexp.Regexp {
+	var exprs []*regexp.Regexp
+	for _, glob := range globs {
+		exprs = append(exprs, globRegexp(glob))
+	}
+	return exprs
+}
+
+func matchesAny(exprs []*regexp.Regexp, functionPath string) bool {
+	for _, expr := range exprs {
+		if expr.MatchString(functionPath) {
+			return true
+		}
+	}
+	return false
+}
+
+func globRegexp(glob string) *regexp.Regexp {
+	var expr bytes.Buffer
+	expr.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			// any number of segments, including none
+			expr.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			expr.WriteString(".*")
+			i++
+		case glob[i] == '*':
+			expr.WriteString("[^/]*")
+		case glob[i] == '?':
+			expr.WriteString("[^/]")
+		default:
+			expr.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+	expr.WriteString("$")
+	// everything but the wildcards is quoted, so the expression is always valid
+	return regexp.MustCompile(expr.String())
+}
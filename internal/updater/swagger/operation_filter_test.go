@@ -0,0 +1,111 @@
+package swagger_test
+
+import (
+	"sort"
+
+	"github.com/ghodss/yaml"
+	"github.com/go-openapi/spec"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/solo-io/gloo-api/pkg/api/types/v1"
+	. "github.com/solo-io/gloo-function-discovery/internal/updater/swagger"
+)
+
+var _ = Describe("OperationFilter", func() {
+	op := func(deprecated bool, tags ...string) spec.OperationProps {
+		return spec.OperationProps{Tags: tags, Deprecated: deprecated}
+	}
+
+	It("includes everything without rules", func() {
+		var filter *OperationFilter
+		Expect(filter.Includes("GET", "/pets", op(true, "admin"))).To(BeTrue())
+		Expect((&OperationFilter{}).Includes("GET", "/pets", op(true, "admin"))).To(BeTrue())
+	})
+	It("matches path globs", func() {
+		filter := &OperationFilter{IncludePaths: []string{"/pets/*"}, ExcludePaths: []string{"/pets/**/admin"}}
+		Expect(filter.Includes("GET", "/pets/{id}", op(false))).To(BeTrue())
+		Expect(filter.Includes("GET", "/pets/{id}/owner", op(false))).To(BeFalse())
+		Expect(filter.Includes("GET", "/pets", op(false))).To(BeFalse())
+
+		filter = &OperationFilter{ExcludePaths: []string{"/pets/**/admin"}}
+		Expect(filter.Includes("GET", "/pets/{id}/owner/admin", op(false))).To(BeFalse())
+		Expect(filter.Includes("GET", "/pets/{id}/owner", op(false))).To(BeTrue())
+	})
+	It("matches no segments with **", func() {
+		filter := &OperationFilter{IncludePaths: []string{"/pets/**/photos", "/store/**"}}
+		Expect(filter.Includes("GET", "/pets/photos", op(false))).To(BeTrue())
+		Expect(filter.Includes("GET", "/pets/{id}/photos", op(false))).To(BeTrue())
+		Expect(filter.Includes("GET", "/pets/{id}/owner/photos", op(false))).To(BeTrue())
+		Expect(filter.Includes("GET", "/pets/selfphotos", op(false))).To(BeFalse())
+		Expect(filter.Includes("GET", "/store/orders/{id}", op(false))).To(BeTrue())
+	})
+	It("matches the globs of a parsed filter", func() {
+		var filter OperationFilter
+		Expect(yaml.Unmarshal([]byte(`{"include_paths": ["/pets/**/photos"], "exclude_paths": ["/pets/*/photos"]}`), &filter)).To(Succeed())
+		Expect(filter.Includes("GET", "/pets/photos", op(false))).To(BeTrue())
+		Expect(filter.Includes("GET", "/pets/{id}/photos", op(false))).To(BeFalse())
+	})
+	It("matches methods, tags and the deprecated flag", func() {
+		filter := &OperationFilter{
+			IncludeMethods:    []string{"get", "post"},
+			ExcludeMethods:    []string{"POST"},
+			IncludeTags:       []string{"pets", "store"},
+			ExcludeTags:       []string{"internal"},
+			ExcludeDeprecated: true,
+		}
+		Expect(filter.Includes("GET", "/pets", op(false, "pets"))).To(BeTrue())
+		Expect(filter.Includes("POST", "/pets", op(false, "pets"))).To(BeFalse())
+		Expect(filter.Includes("PUT", "/pets", op(false, "pets"))).To(BeFalse())
+		Expect(filter.Includes("GET", "/pets", op(false))).To(BeFalse())
+		Expect(filter.Includes("GET", "/pets", op(false, "store", "internal"))).To(BeFalse())
+		Expect(filter.Includes("GET", "/pets", op(true, "pets"))).To(BeFalse())
+	})
+	It("applies the filter annotation before creating functions", func() {
+		us := &v1.Upstream{
+			Name: "filtered",
+			Metadata: &v1.Metadata{Annotations: map[string]string{
+				AnnotationKeySwaggerDoc: filterDoc,
+			}},
+		}
+		names := func() []string {
+			funcs, err := getFuncs(us)
+			Expect(err).NotTo(HaveOccurred())
+			var names []string
+			for _, fn := range funcs {
+				names = append(names, fn.Name)
+			}
+			sort.Strings(names)
+			return names
+		}
+		Expect(names()).To(Equal([]string{"deleteUser", "getPet", "getUser", "oldGetPet"}))
+
+		us.Metadata.Annotations[AnnotationKeyOperationFilter] = `
+exclude_tags: [admin]
+exclude_deprecated: true`
+		Expect(names()).To(Equal([]string{"getPet", "getUser"}))
+
+		us.Metadata.Annotations[AnnotationKeyOperationFilter] = `{"include_paths": ["/users/*"], "include_methods": ["GET"]}`
+		Expect(names()).To(Equal([]string{"getUser"}))
+
+		us.Metadata.Annotations[AnnotationKeyOperationFilter] = `include_paths: {`
+		_, err := getFuncs(us)
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+const filterDoc = `{
+  "swagger": "2.0",
+  "paths": {
+    "/pets/{id}": {
+      "get": {"operationId": "getPet", "tags": ["pets"], "responses": {"200": {"description": "pet"}}}
+    },
+    "/v1/pets/{id}": {
+      "get": {"operationId": "oldGetPet", "deprecated": true, "responses": {"200": {"description": "pet"}}}
+    },
+    "/users/{id}": {
+      "get": {"operationId": "getUser", "tags": ["users"], "responses": {"200": {"description": "user"}}},
+      "delete": {"operationId": "deleteUser", "tags": ["users", "admin"], "responses": {"200": {"description": "deleted"}}}
+    }
+  }
+}`
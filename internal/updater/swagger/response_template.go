@@ -0,0 +1,111 @@
+package swagger
+
+import (
+	"sort"
+	"strconv"
+
+	"github.com/go-openapi/spec"
+	"github.com/gogo/protobuf/types"
+	"github.com/pkg/errors"
+
+	"github.com/solo-io/gloo-api/pkg/api/types/v1"
+)
+
+// field of the function spec holding the response template
+const responseTemplateField = "response_template"
+
+// ResponseTemplate describes the successful response of a discovered REST function.
+// Body is a template over the fields of the upstream response, which routes
+// can use to reshape the response returned to the client
+type ResponseTemplate struct {
+	StatusCode  int
+	ContentType string
+	// name of the swagger definition describing the response, if any
+	SchemaRef string
+	Body      string
+}
+
+// getResponseTemplate builds a template from the lowest 2xx json response of the operation
+func getResponseTemplate(operation spec.OperationProps, produces []string, definitions spec.Definitions) *ResponseTemplate {
+	if operation.Responses == nil {
+		return nil
+	}
+	contentType, ok := negotiateContentType(produces)
+	if !ok {
+		return nil
+	}
+	var codes []int
+	for code, response := range operation.Responses.StatusCodeResponses {
+		if code >= 200 && code < 300 && response.Schema != nil {
+			codes = append(codes, code)
+		}
+	}
+	if len(codes) == 0 {
+		return nil
+	}
+	sort.Ints(codes)
+	schema := operation.Responses.StatusCodeResponses[codes[0]].Schema
+	return &ResponseTemplate{
+		StatusCode:  codes[0],
+		ContentType: contentType,
+		SchemaRef:   definitionName(schema.Ref),
+		Body:        getBodyTemplate("body", schema, definitions),
+	}
+}
+
+func addResponseTemplate(fn *v1.Function, tmpl *ResponseTemplate) {
+	if fn.Spec == nil {
+		fn.Spec = &types.Struct{}
+	}
+	if fn.Spec.Fields == nil {
+		fn.Spec.Fields = make(map[string]*types.Value)
+	}
+	fn.Spec.Fields[responseTemplateField] = &types.Value{Kind: &types.Value_StructValue{StructValue: &types.Struct{
+		Fields: map[string]*types.Value{
+			"status_code":  {Kind: &types.Value_NumberValue{NumberValue: float64(tmpl.StatusCode)}},
+			"content_type": {Kind: &types.Value_StringValue{StringValue: tmpl.ContentType}},
+			"schema_ref":   {Kind: &types.Value_StringValue{StringValue: tmpl.SchemaRef}},
+			"body":         {Kind: &types.Value_StringValue{StringValue: tmpl.Body}},
+		},
+	}}}
+}
+
+// DecodeResponseTemplate returns the response template of a discovered function,
+// or nil if it has none
+func DecodeResponseTemplate(fn *v1.Function) (*ResponseTemplate, error) {
+	if fn.Spec == nil {
+		return nil, nil
+	}
+	val, ok := fn.Spec.Fields[responseTemplateField]
+	if !ok {
+		return nil, nil
+	}
+	structVal, ok := val.Kind.(*types.Value_StructValue)
+	if !ok || structVal.StructValue == nil {
+		return nil, errors.Errorf("%v must be a struct", responseTemplateField)
+	}
+	fields := structVal.StructValue.Fields
+	stringField := func(key string) string {
+		if v, ok := fields[key].GetKind().(*types.Value_StringValue); ok {
+			return v.StringValue
+		}
+		return ""
+	}
+	tmpl := &ResponseTemplate{
+		ContentType: stringField("content_type"),
+		SchemaRef:   stringField("schema_ref"),
+		Body:        stringField("body"),
+	}
+	if v, ok := fields["status_code"].GetKind().(*types.Value_NumberValue); ok {
+		tmpl.StatusCode = int(v.NumberValue)
+	}
+	return tmpl, nil
+}
+
+func responseTemplatesEnabled(us *v1.Upstream) bool {
+	if us.Metadata == nil {
+		return false
+	}
+	enabled, _ := strconv.ParseBool(us.Metadata.Annotations[AnnotationKeyResponseTemplates])
+	return enabled
+}
@@ -1,43 +1,53 @@
 package updater
 
 import (
-	"sort"
-
+	"context"
+	"encoding/json"
 	"reflect"
+	"sort"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/solo-io/gloo-api/pkg/api/types/v1"
 	"github.com/solo-io/gloo-function-discovery/internal/detector"
-	"github.com/solo-io/gloo-function-discovery/internal/updater/gcf"
-	"github.com/solo-io/gloo-function-discovery/internal/updater/lambda"
-	"github.com/solo-io/gloo-function-discovery/internal/updater/openfaas"
-	"github.com/solo-io/gloo-function-discovery/internal/updater/swagger"
+	"github.com/solo-io/gloo-function-discovery/internal/metrics"
 	"github.com/solo-io/gloo-function-discovery/pkg/backoff"
 	"github.com/solo-io/gloo-function-discovery/pkg/functiontypes"
-	"github.com/solo-io/gloo-function-discovery/pkg/resolver"
 
 	"github.com/solo-io/gloo-storage"
 	"github.com/solo-io/gloo/pkg/log"
 	"github.com/solo-io/gloo/pkg/secretwatcher"
 )
 
-func GetSecretRefsToWatch(upstreams []*v1.Upstream) []string {
+// AnnotationKeyDiscoveredFunctions lists the functions on the upstream that were
+// created by function discovery, as a json array of function names
+const AnnotationKeyDiscoveredFunctions = "gloo.solo.io/discovered_functions"
+
+// AnnotationKeyDiscoveredService records the annotations on the upstream that were
+// written by detection, and whether it wrote the service info, as json. the others
+// were set by users, and are only overwritten by a forced detection
+const AnnotationKeyDiscoveredService = "gloo.solo.io/discovered_service"
+
+func GetSecretRefsToWatch(sources *functiontypes.Registry, upstreams []*v1.Upstream) []string {
 	var refs []string
 	for _, us := range upstreams {
-		switch functiontypes.GetFunctionType(us) {
-		case functiontypes.FunctionTypeLambda:
-			ref, err := lambda.GetSecretRef(us)
-			if err != nil {
-				continue
-			}
-			refs = append(refs, ref)
-		case functiontypes.FunctionTypeGfuncs:
-			ref, err := gcf.GetSecretRef(us)
-			if err != nil {
-				continue
-			}
-			refs = append(refs, ref)
+		source := sources.SourceFor(us)
+		if source == nil {
+			continue
 		}
+		refs = append(refs, source.SecretRefs(us)...)
+	}
+	return refs
+}
+
+func GetFileRefsToWatch(sources *functiontypes.Registry, upstreams []*v1.Upstream) []string {
+	var refs []string
+	for _, us := range upstreams {
+		consumer, ok := sources.SourceFor(us).(functiontypes.FileConsumer)
+		if !ok {
+			continue
+		}
+		refs = append(refs, consumer.FileRefs(us)...)
 	}
 	return refs
 }
@@ -46,80 +56,83 @@ func GetSecretRefsToWatch(upstreams []*v1.Upstream) []string {
 // we want to forceSync on every refreshDuration
 // on a config / secrets change, we don't want to force sync
 // else we can get into an update loop
-func UpdateFunctions(resolve resolver.Resolver, gloo storage.Interface, upstreamName string, secrets secretwatcher.SecretMap) error {
+func UpdateFunctions(ctx context.Context, policy backoff.Policy, sources *functiontypes.Registry, gloo storage.Interface, upstreamName string, secrets secretwatcher.SecretMap) error {
 	us, err := gloo.V1().Upstreams().Get(upstreamName)
 	if err != nil {
 		return errors.Wrapf(err, "failed to get existing upstream with name %v", upstreamName)
 	}
 
-	var funcs []*v1.Function
-	switch functiontypes.GetFunctionType(us) {
-	case functiontypes.FunctionTypeLambda:
-		if len(secrets) == 0 {
-			log.Warnf("lambda upstream detected, but no secrets have been read yet")
-			return nil
-		}
-		funcs, err = lambda.GetFuncs(us, secrets)
-		if err != nil {
-			return errors.Wrap(err, "retrieving lambda functions")
-		}
-	case functiontypes.FunctionTypeGfuncs:
-		if len(secrets) == 0 {
-			log.Warnf("google functions upstream detected, but no secrets have been read yet")
-			return nil
-		}
-		funcs, err = gcf.GetFuncs(us, secrets)
-		if err != nil {
-			return errors.Wrap(err, "retrieving google functions")
-		}
-	case functiontypes.FunctionTypeSwagger:
-		funcs, err = swagger.GetFuncs(us)
-		if err != nil {
-			return errors.Wrap(err, "retrieving swagger functions")
-		}
-	case functiontypes.FunctionTypeOpenFaas:
-		funcs, err = openfaas.GetFuncs(resolve, us)
-		if err != nil {
-			return errors.Wrap(err, "updating faas functions")
-		}
-	default:
+	source := sources.SourceFor(us)
+	if source == nil {
 		return nil //errors.Errorf("unknown function type")
 	}
+	if len(source.SecretRefs(us)) > 0 && len(secrets) == 0 {
+		log.Warnf("%v upstream detected, but no secrets have been read yet", source.Name())
+		return nil
+	}
+
+	start := time.Now()
+	funcs, err := source.GetFuncs(us, secrets)
+	metrics.FunctionFetchDuration.WithLabelValues(source.Name(), metrics.Result(err)).Observe(time.Since(start).Seconds())
+	if err != nil {
+		return errors.Wrapf(err, "retrieving %v functions", source.Name())
+	}
 
-	if err := updateUpstreamWithFuncs(gloo, us.Name, funcs); err != nil {
+	if err := updateUpstreamWithFuncs(ctx, policy, gloo, us.Name, funcs); err != nil {
 		return errors.Wrap(err, "updating upstream object with new funcs")
 	}
 	return nil
 }
 
-func updateUpstreamWithFuncs(gloo storage.Interface, upstreamName string, funcs []*v1.Function) error {
+func updateUpstreamWithFuncs(ctx context.Context, policy backoff.Policy, gloo storage.Interface, upstreamName string, funcs []*v1.Function) error {
 	// sort funcs for idempotency
 	sort.SliceStable(funcs, func(i, j int) bool {
 		return funcs[i].Name < funcs[j].Name
 	})
 
-	usToUpdate, err := gloo.V1().Upstreams().Get(upstreamName)
+	ownedAnnotation, err := ownedFunctionsAnnotation(funcs)
 	if err != nil {
-		return errors.Wrapf(err, "failed to get existing upstream with name %v", upstreamName)
+		return errors.Wrap(err, "encoding discovered functions annotation")
 	}
 
-	// no update to do
-	if functionListsEqual(usToUpdate.Functions, funcs) {
-		return nil
-	}
+	// re-read and re-merge on every attempt, the upstream may have been
+	// modified since the last one
+	return retryOnConflict(ctx, policy, upstreamName, func() error {
+		usToUpdate, err := gloo.V1().Upstreams().Get(upstreamName)
+		if err != nil {
+			return errors.Wrapf(err, "failed to get existing upstream with name %v", upstreamName)
+		}
 
-	usToUpdate.Functions = mergeFuncs(usToUpdate.Functions, funcs)
+		owned, err := getOwnedFunctions(usToUpdate)
+		if err != nil {
+			return errors.Wrapf(err, "reading discovered functions on upstream %v", upstreamName)
+		}
+		mergedFuncs := mergeFuncs(usToUpdate.Functions, funcs, owned)
 
-	_, err = gloo.V1().Upstreams().Update(usToUpdate)
-	if err != nil {
-		return err
-	}
-	return nil
+		// no update to do
+		if functionListsEqual(usToUpdate.Functions, mergedFuncs) && containsAnnotations(usToUpdate, ownedAnnotation) {
+			return nil
+		}
+
+		if usToUpdate.Metadata == nil {
+			usToUpdate.Metadata = &v1.Metadata{}
+		}
+		usToUpdate.Metadata.Annotations = mergeAnnotations(usToUpdate.Metadata.Annotations, ownedAnnotation)
+		usToUpdate.Functions = mergedFuncs
+
+		if _, err := gloo.V1().Upstreams().Update(usToUpdate); err != nil {
+			return err
+		}
+		metrics.UpstreamWrites.WithLabelValues(metrics.WriteFunctions).Inc()
+		return nil
+	})
 }
 
 // get the unique set of funcs between two lists
 // if conflict, new wins
-func mergeFuncs(oldFuncs, newFuncs []*v1.Function) []*v1.Function {
+// old funcs that were created by discovery are removed if they are
+// missing from the new list. user-created funcs are never removed
+func mergeFuncs(oldFuncs, newFuncs []*v1.Function, owned map[string]bool) []*v1.Function {
 	var notReplaced []*v1.Function
 	for _, oldFunc := range oldFuncs {
 		var replace bool
@@ -132,11 +145,49 @@ func mergeFuncs(oldFuncs, newFuncs []*v1.Function) []*v1.Function {
 		if replace {
 			continue
 		}
+		if owned[oldFunc.Name] {
+			log.Debugf("pruning function %v, it no longer exists in the function source", oldFunc.Name)
+			continue
+		}
 		notReplaced = append(notReplaced, oldFunc)
 	}
 	return append(notReplaced, newFuncs...)
 }
 
+// the names of the functions written by discovery are stored in an annotation
+// on the upstream, so that functions authored by users can be told apart
+func getOwnedFunctions(us *v1.Upstream) (map[string]bool, error) {
+	owned := make(map[string]bool)
+	if us.Metadata == nil {
+		return owned, nil
+	}
+	annotation, ok := us.Metadata.Annotations[AnnotationKeyDiscoveredFunctions]
+	if !ok || annotation == "" {
+		return owned, nil
+	}
+	var names []string
+	if err := json.Unmarshal([]byte(annotation), &names); err != nil {
+		return nil, errors.Wrapf(err, "invalid value for annotation %v", AnnotationKeyDiscoveredFunctions)
+	}
+	for _, name := range names {
+		owned[name] = true
+	}
+	return owned, nil
+}
+
+func ownedFunctionsAnnotation(funcs []*v1.Function) (map[string]string, error) {
+	names := []string{}
+	for _, fn := range funcs {
+		names = append(names, fn.Name)
+	}
+	sort.Strings(names)
+	b, err := json.Marshal(names)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{AnnotationKeyDiscoveredFunctions: string(b)}, nil
+}
+
 func functionListsEqual(funcs1, funcs2 []*v1.Function) bool {
 	if len(funcs1) != len(funcs2) {
 		return false
@@ -152,7 +203,9 @@ func functionListsEqual(funcs1, funcs2 []*v1.Function) bool {
 }
 
 // update the upstream with service info and annotations
-func UpdateServiceInfo(gloo storage.Interface,
+func UpdateServiceInfo(ctx context.Context,
+	policy backoff.Policy,
+	gloo storage.Interface,
 	upstreamName string,
 	marker *detector.Marker) error {
 
@@ -168,7 +221,7 @@ func UpdateServiceInfo(gloo storage.Interface,
 		return errors.Wrapf(err, "failed to discover whether %v is a functional upstream", upstreamName)
 	}
 
-	return backoff.WithBackoff(func() error {
+	return backoff.Retry(ctx, policy, func() error {
 		usToUpdate, err := gloo.V1().Upstreams().Get(upstreamName)
 		if err != nil {
 			return errors.Wrapf(err, "failed to get existing upstream with name %v", upstreamName)
@@ -179,20 +232,106 @@ func UpdateServiceInfo(gloo storage.Interface,
 			return nil
 		}
 
+		// detection succeeded, a forced detection is done
+		forced := detector.ForceDetection(usToUpdate)
+
+		changed, err := applyDetection(usToUpdate, svcInfo, annotations, forced)
+		if err != nil {
+			return err
+		}
 		// no update to do
-		if svcInfoEqual(usToUpdate, svcInfo) && containsAnnotations(usToUpdate, annotations) {
+		if !changed && !forced {
 			return nil
 		}
-
-		usToUpdate.Metadata.Annotations = mergeAnnotations(usToUpdate.Metadata.Annotations, annotations)
-		usToUpdate.ServiceInfo = svcInfo
+		delete(usToUpdate.Metadata.Annotations, detector.AnnotationKeyForceDetection)
 
 		if _, err := gloo.V1().Upstreams().Update(usToUpdate); err != nil {
 			return errors.Wrapf(err, "updating upstream %s with service info", upstreamName)
 		}
+		metrics.UpstreamWrites.WithLabelValues(metrics.WriteServiceInfo).Inc()
 		log.Printf("updated upstream %v", usToUpdate)
 		return nil
-	}, make(chan struct{}))
+	})
+}
+
+type discoveredService struct {
+	Annotations []string `json:"annotations,omitempty"`
+	ServiceInfo bool     `json:"service_info,omitempty"`
+}
+
+func getDiscoveredService(us *v1.Upstream) (discoveredService, error) {
+	var discovered discoveredService
+	if us.Metadata == nil || us.Metadata.Annotations[AnnotationKeyDiscoveredService] == "" {
+		return discovered, nil
+	}
+	if err := json.Unmarshal([]byte(us.Metadata.Annotations[AnnotationKeyDiscoveredService]), &discovered); err != nil {
+		return discovered, errors.Wrapf(err, "invalid value for annotation %v", AnnotationKeyDiscoveredService)
+	}
+	return discovered, nil
+}
+
+// applyDetection writes the detected service info and annotations to the upstream.
+// values set by users are kept unless the detection was forced, annotations written
+// by an earlier detection are removed when the detection no longer returns them.
+// upstreams detected before detections were recorded are adopted where they agree
+// with the detection: their service info if it has the detected type, and their
+// annotations with the detected values. returns whether the upstream changed
+func applyDetection(us *v1.Upstream, svcInfo *v1.ServiceInfo, annotations map[string]string, forced bool) (bool, error) {
+	discovered, err := getDiscoveredService(us)
+	if err != nil {
+		return false, err
+	}
+	if us.Metadata == nil {
+		us.Metadata = &v1.Metadata{}
+	}
+	_, recorded := us.Metadata.Annotations[AnnotationKeyDiscoveredService]
+	owned := make(map[string]bool)
+	for _, key := range discovered.Annotations {
+		owned[key] = true
+	}
+
+	before := mergeAnnotations(us.Metadata.Annotations, nil)
+	merged := mergeAnnotations(us.Metadata.Annotations, nil)
+	// stale annotations of an earlier detection, e.g. of another service type
+	for key := range owned {
+		if _, ok := annotations[key]; !ok {
+			delete(merged, key)
+		}
+	}
+	written := make(map[string]bool)
+	for key, value := range annotations {
+		current, set := merged[key]
+		adopted := !recorded && current == value
+		if set && !owned[key] && !forced && !adopted {
+			continue
+		}
+		merged[key] = value
+		written[key] = true
+	}
+
+	changed := false
+	result := discoveredService{ServiceInfo: discovered.ServiceInfo}
+	adopted := !recorded && us.ServiceInfo != nil && us.ServiceInfo.Type == svcInfo.GetType()
+	if us.ServiceInfo == nil || discovered.ServiceInfo || forced || adopted {
+		changed = !svcInfoEqual(us, svcInfo)
+		us.ServiceInfo = svcInfo
+		result.ServiceInfo = svcInfo != nil
+	}
+	for key := range written {
+		result.Annotations = append(result.Annotations, key)
+	}
+	sort.Strings(result.Annotations)
+	delete(merged, AnnotationKeyDiscoveredService)
+	if len(result.Annotations) > 0 || result.ServiceInfo {
+		b, err := json.Marshal(result)
+		if err != nil {
+			return false, err
+		}
+		merged[AnnotationKeyDiscoveredService] = string(b)
+	}
+
+	us.Metadata.Annotations = merged
+	return changed || !reflect.DeepEqual(before, merged), nil
 }
 
 // get the unique set of funcs between two lists
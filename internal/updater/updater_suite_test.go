@@ -0,0 +1,13 @@
+package updater
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestUpdater(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Updater Suite")
+}
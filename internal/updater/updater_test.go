@@ -0,0 +1,160 @@
+package updater
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+	kubeerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/solo-io/gloo-api/pkg/api/types/v1"
+	"github.com/solo-io/gloo-function-discovery/pkg/backoff"
+)
+
+var _ = Describe("Updater", func() {
+	Describe("mergeFuncs", func() {
+		It("prunes discovered functions that are gone, and keeps user functions", func() {
+			oldFuncs := []*v1.Function{
+				{Name: "user-fn"},
+				{Name: "deleted-fn"},
+				{Name: "kept-fn"},
+			}
+			newFuncs := []*v1.Function{
+				{Name: "kept-fn"},
+				{Name: "new-fn"},
+			}
+			owned := map[string]bool{"deleted-fn": true, "kept-fn": true}
+			Expect(mergeFuncs(oldFuncs, newFuncs, owned)).To(Equal([]*v1.Function{
+				{Name: "user-fn"},
+				{Name: "kept-fn"},
+				{Name: "new-fn"},
+			}))
+		})
+	})
+	Describe("owned functions annotation", func() {
+		It("round trips the discovered function names", func() {
+			annotations, err := ownedFunctionsAnnotation([]*v1.Function{{Name: "b"}, {Name: "a"}})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(annotations).To(Equal(map[string]string{AnnotationKeyDiscoveredFunctions: `["a","b"]`}))
+
+			owned, err := getOwnedFunctions(&v1.Upstream{Metadata: &v1.Metadata{Annotations: annotations}})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(owned).To(Equal(map[string]bool{"a": true, "b": true}))
+		})
+		It("treats upstreams without the annotation as owning nothing", func() {
+			owned, err := getOwnedFunctions(&v1.Upstream{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(owned).To(BeEmpty())
+		})
+	})
+	Describe("applyDetection", func() {
+		const swaggerURL = "gloo.solo.io/swagger_url"
+		detected := map[string]string{swaggerURL: "http://petstore/swagger.json"}
+		restInfo := &v1.ServiceInfo{Type: "REST"}
+
+		It("keeps a swagger url set by the user when detecting again", func() {
+			us := &v1.Upstream{
+				Metadata:    &v1.Metadata{Annotations: map[string]string{swaggerURL: "http://petstore/v2/swagger.json"}},
+				ServiceInfo: &v1.ServiceInfo{Type: "user"},
+			}
+			changed, err := applyDetection(us, restInfo, detected, false)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(changed).To(BeFalse())
+			Expect(us.Metadata.Annotations).To(Equal(map[string]string{swaggerURL: "http://petstore/v2/swagger.json"}))
+			Expect(us.ServiceInfo).To(Equal(&v1.ServiceInfo{Type: "user"}))
+		})
+		It("updates what it detected before", func() {
+			us := &v1.Upstream{}
+			changed, err := applyDetection(us, restInfo, detected, false)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(changed).To(BeTrue())
+			Expect(us.ServiceInfo).To(Equal(restInfo))
+			Expect(us.Metadata.Annotations[AnnotationKeyDiscoveredService]).To(Equal(`{"annotations":["` + swaggerURL + `"],"service_info":true}`))
+
+			changed, err = applyDetection(us, restInfo, detected, false)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(changed).To(BeFalse())
+
+			changed, err = applyDetection(us, restInfo, map[string]string{swaggerURL: "http://petstore/v3/swagger.json"}, false)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(changed).To(BeTrue())
+			Expect(us.Metadata.Annotations[swaggerURL]).To(Equal("http://petstore/v3/swagger.json"))
+		})
+		It("removes the annotations of an earlier detection of another type", func() {
+			us := &v1.Upstream{}
+			_, err := applyDetection(us, restInfo, detected, false)
+			Expect(err).NotTo(HaveOccurred())
+
+			grpcInfo := &v1.ServiceInfo{Type: "gRPC"}
+			changed, err := applyDetection(us, grpcInfo, nil, false)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(changed).To(BeTrue())
+			Expect(us.ServiceInfo).To(Equal(grpcInfo))
+			Expect(us.Metadata.Annotations).To(Equal(map[string]string{
+				AnnotationKeyDiscoveredService: `{"service_info":true}`,
+			}))
+		})
+		It("adopts what an earlier, unrecorded detection wrote", func() {
+			us := &v1.Upstream{
+				Metadata:    &v1.Metadata{Annotations: map[string]string{swaggerURL: "http://petstore/swagger.json"}},
+				ServiceInfo: &v1.ServiceInfo{Type: "REST"},
+			}
+			changed, err := applyDetection(us, restInfo, detected, false)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(changed).To(BeTrue())
+			Expect(us.Metadata.Annotations[AnnotationKeyDiscoveredService]).To(Equal(`{"annotations":["` + swaggerURL + `"],"service_info":true}`))
+
+			changed, err = applyDetection(us, restInfo, map[string]string{swaggerURL: "http://petstore/v3/swagger.json"}, false)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(changed).To(BeTrue())
+			Expect(us.Metadata.Annotations[swaggerURL]).To(Equal("http://petstore/v3/swagger.json"))
+		})
+		It("overwrites values set by the user when forced", func() {
+			us := &v1.Upstream{
+				Metadata:    &v1.Metadata{Annotations: map[string]string{swaggerURL: "http://petstore/v2/swagger.json"}},
+				ServiceInfo: &v1.ServiceInfo{Type: "user"},
+			}
+			changed, err := applyDetection(us, restInfo, detected, true)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(changed).To(BeTrue())
+			Expect(us.Metadata.Annotations[swaggerURL]).To(Equal("http://petstore/swagger.json"))
+			Expect(us.ServiceInfo).To(Equal(restInfo))
+		})
+	})
+	Describe("retryOnConflict", func() {
+		policy := backoff.Policy{InitialInterval: time.Millisecond, Multiplier: 2, MaxAttempts: 5}
+		conflict := kubeerrors.NewConflict(schema.GroupResource{Resource: "upstreams"}, "us", errors.New("stale"))
+		It("retries conflicts until the write succeeds", func() {
+			var attempts int
+			err := retryOnConflict(context.Background(), policy, "us", func() error {
+				attempts++
+				if attempts < 3 {
+					return errors.Wrap(conflict, "updating")
+				}
+				return nil
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(attempts).To(Equal(3))
+		})
+		It("does not retry other errors", func() {
+			var attempts int
+			err := retryOnConflict(context.Background(), policy, "us", func() error {
+				attempts++
+				return errors.New("boom")
+			})
+			Expect(err).To(HaveOccurred())
+			Expect(IsConflict(err)).To(BeFalse())
+			Expect(attempts).To(Equal(1))
+		})
+		It("surfaces a conflict error when retries are exhausted", func() {
+			err := retryOnConflict(context.Background(), policy, "us", func() error {
+				return conflict
+			})
+			Expect(IsConflict(err)).To(BeTrue())
+			Expect(err.(*ConflictError).Attempts).To(Equal(policy.MaxAttempts))
+		})
+	})
+})
@@ -12,15 +12,16 @@ func WatchUpstreams(gloo storage.Interface,
 	errs chan error) (<-chan []*v1.Upstream, error) {
 
 	upstreams := make(chan []*v1.Upstream)
+	// the list is sent even when it's empty, so the resources of the last
+	// upstreams are cleaned up once they are deleted
 	syncFunc := func(newList []*v1.Upstream, _ *v1.Upstream) {
-		if len(newList) > 0 {
-			upstreams <- newList
-		}
+		upstreams <- newList
 	}
 
 	w, err := gloo.V1().Upstreams().Watch(storage.UpstreamEventHandlerFuncs{
 		AddFunc:    syncFunc,
 		UpdateFunc: syncFunc,
+		DeleteFunc: syncFunc,
 	})
 	if err != nil {
 		return nil, err
@@ -2,15 +2,24 @@ package main
 
 import (
 	"fmt"
+	"net/http"
 	"os"
 	"strings"
 	"time"
 
+	"github.com/pkg/errors"
 	"github.com/solo-io/gloo-storage/crd"
 	"github.com/spf13/cobra"
 
+	"github.com/solo-io/gloo-function-discovery/internal/detector"
 	"github.com/solo-io/gloo-function-discovery/internal/eventloop"
+	grpcdetector "github.com/solo-io/gloo-function-discovery/internal/grpc"
+	"github.com/solo-io/gloo-function-discovery/internal/health"
+	"github.com/solo-io/gloo-function-discovery/internal/metrics"
 	"github.com/solo-io/gloo-function-discovery/internal/options"
+	"github.com/solo-io/gloo-function-discovery/internal/updater/nats"
+	"github.com/solo-io/gloo-function-discovery/internal/updater/swagger"
+	"github.com/solo-io/gloo-function-discovery/pkg/backoff"
 	"github.com/solo-io/gloo/pkg/bootstrap"
 	"github.com/solo-io/gloo/pkg/log"
 	"github.com/solo-io/gloo/pkg/signals"
@@ -26,6 +35,12 @@ func main() {
 var (
 	opts          bootstrap.Options
 	discoveryOpts options.DiscoveryOptions
+	adminAddr     string
+	// shared by the swagger detector and function discovery. the ttl is set once flags are parsed
+	swaggerDocs = swagger.NewDocCache(0)
+	detectors   = eventloop.DefaultDetectors(swaggerDocs)
+	// the event loop is considered stuck if it makes no progress for this long
+	progressTimeout time.Duration
 )
 
 var rootCmd = &cobra.Command{
@@ -36,8 +51,22 @@ var rootCmd = &cobra.Command{
 		stop := signals.SetupSignalHandler()
 		errs := make(chan error)
 
+		checker := health.NewChecker(progressTimeout,
+			health.ComponentStorage,
+			health.ComponentUpstreams,
+			health.ComponentSecrets)
+
+		if adminAddr != "" {
+			go func() {
+				if err := serveAdmin(adminAddr, checker, stop); err != nil {
+					errs <- err
+				}
+			}()
+		}
+
+		swaggerDocs.SetTTL(discoveryOpts.SwaggerCacheTTL)
 		finished := make(chan error)
-		go func() { finished <- eventloop.Run(opts, discoveryOpts, stop, errs) }()
+		go func() { finished <- eventloop.Run(opts, discoveryOpts, detectors, swaggerDocs, checker, stop, errs) }()
 		go func() {
 			for {
 				select {
@@ -50,6 +79,23 @@ var rootCmd = &cobra.Command{
 	},
 }
 
+// serves the metrics and health endpoints until stop is closed
+func serveAdmin(addr string, checker *health.Checker, stop <-chan struct{}) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	mux.Handle("/healthz", checker.HealthzHandler())
+	mux.Handle("/readyz", checker.ReadyzHandler())
+	srv := &http.Server{Addr: addr, Handler: mux}
+	go func() {
+		<-stop
+		srv.Close()
+	}()
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		return errors.Wrapf(err, "serving admin endpoints on %v", addr)
+	}
+	return nil
+}
+
 func init() {
 	// config watcher
 	rootCmd.PersistentFlags().StringVar(&opts.ConfigWatcherOptions.Type, "storage.type", bootstrap.WatcherTypeKube, fmt.Sprintf("storage backend for config objects. supported: [%s]", strings.Join(bootstrap.SupportedCwTypes, " | ")))
@@ -87,11 +133,59 @@ func init() {
 	rootCmd.PersistentFlags().StringVar(&opts.VaultOptions.AuthToken, "vault.token", "", "auth token for reading vault secrets")
 	rootCmd.PersistentFlags().IntVar(&opts.VaultOptions.Retries, "vault.retries", 3, "number of times to retry failed requests to vault")
 
+	// discovery config file
+	rootCmd.PersistentFlags().StringVar(&discoveryOpts.ConfigFile, "config", "", "optional yaml file configuring function discovery. "+
+		"its detectors section enables, orders and configures upstream service type detectors, overriding the detector flags. "+
+		"its swagger_operation_filter section selects the swagger operations that become functions, unless an upstream sets the "+
+		swagger.AnnotationKeyOperationFilter+" annotation")
+
 	// upstream service type detection
-	rootCmd.PersistentFlags().BoolVar(&discoveryOpts.AutoDiscoverSwagger, "detect-swagger-upstreams", true, "enable automatic discovery of upstreams that implement Swagger by querying for common Swagger Doc endpoints.")
-	rootCmd.PersistentFlags().BoolVar(&discoveryOpts.AutoDiscoverNATS, "detect-nats-upstreams", true, "enable automatic discovery of upstreams that are running NATS by connecting to the default cluster id.")
-	rootCmd.PersistentFlags().BoolVar(&discoveryOpts.AutoDiscoverGRPC, "detect-grpc-upstreams", true, "enable automatic discovery of upstreams that are running gRPC Services and haeve reflection enabled.")
-	rootCmd.PersistentFlags().BoolVar(&discoveryOpts.AutoDiscoverFAAS, "detect-faas-upstreams", true, "enable automatic discovery open faas upstreams.")
-	rootCmd.PersistentFlags().StringSliceVar(&discoveryOpts.SwaggerUrisToTry, "swagger-uris", []string{}, "paths function discovery should try to use to discover swagger services. function discovery will query http://<upstream>/<uri> for the swagger.json document. "+
-		"if found, REST functions will be discovered for this upstream.")
+	detectors.AddFlags(rootCmd.PersistentFlags())
+	rootCmd.PersistentFlags().StringVar(&discoveryOpts.DetectionPolicy, "detection-policy", string(detector.PolicyPriority),
+		"how to choose between detectors that recognize the same upstream. detectors are prioritized in the order they are listed in the config file. "+
+			"priority: the highest priority detector that succeeds wins. fastest: the first detector to succeed wins. "+
+			"strict: run every detector and apply nothing if they disagree. can be overridden per upstream with the "+detector.AnnotationKeyDetectionPolicy+" annotation")
+
+	// function discovery
+	rootCmd.PersistentFlags().StringSliceVar(&discoveryOpts.FunctionSources, "function-sources",
+		eventloop.FunctionSourceNames(),
+		"function sources to discover functions with. remove a source from the list to disable it.")
+	rootCmd.PersistentFlags().IntVar(&discoveryOpts.NatsMonitoringPort, "nats-monitoring-port", nats.DefaultMonitoringPort,
+		"port of the monitoring endpoint of NATS Streaming upstreams, used to discover channels as functions. "+
+			"an upstream can override the endpoint with the "+nats.AnnotationKeyMonitoringURL+" annotation")
+	rootCmd.PersistentFlags().DurationVar(&discoveryOpts.GRPCReflectionTimeout, "grpc-reflection-timeout", grpcdetector.DefaultTimeout,
+		"timeout for each attempt to connect to a gRPC upstream and reflect its services to discover methods as functions")
+	rootCmd.PersistentFlags().DurationVar(&discoveryOpts.SwaggerCacheTTL, "swagger-cache-ttl", time.Minute,
+		"reuse fetched swagger docs for detection and function discovery for this long. after that, "+
+			"docs are requested again with If-None-Match / If-Modified-Since and functions are only regenerated if the doc changed")
+
+	// admin
+	rootCmd.PersistentFlags().StringVar(&adminAddr, "admin.addr", ":9091", "address to serve prometheus metrics (/metrics) and health checks (/healthz, /readyz) on. leave empty to disable")
+	rootCmd.PersistentFlags().DurationVar(&progressTimeout, "health.progress-timeout", time.Minute, "report discovery as unhealthy if the event loop makes no progress for this long")
+
+	// retries
+	addBackoffFlags("detection.backoff", "detecting the service type of an upstream", &discoveryOpts.DetectionBackoff)
+	rootCmd.PersistentFlags().DurationVar(&discoveryOpts.DetectionTimeout, "detection.timeout", 10*time.Second,
+		"stop retrying each detector after this long, so that detectors that don't recognize an upstream don't delay the others. 0 means no limit")
+
+	// re-detection
+	rootCmd.PersistentFlags().DurationVar(&discoveryOpts.DetectionSchedule.RedetectInterval, "redetect-interval", 30*time.Minute,
+		"detect the service type of upstreams that were already detected again after this long. 0 disables re-detection. "+
+			"set the "+detector.AnnotationKeyForceDetection+" annotation to \"true\" to detect an upstream on the next sync")
+	cooldown := &discoveryOpts.DetectionSchedule.FailureCooldown
+	rootCmd.PersistentFlags().DurationVar(&cooldown.InitialInterval, "detection.cooldown.initial-interval", 30*time.Second, "wait before detecting an upstream again after detection failed")
+	rootCmd.PersistentFlags().DurationVar(&cooldown.MaxInterval, "detection.cooldown.max-interval", 30*time.Minute, "maximum wait before detecting an upstream again after repeated failures. 0 means no limit")
+	rootCmd.PersistentFlags().Float64Var(&cooldown.Multiplier, "detection.cooldown.multiplier", 2, "factor the wait grows by after each failed detection of an upstream")
+	rootCmd.PersistentFlags().Float64Var(&cooldown.Jitter, "detection.cooldown.jitter", 0.2, "fraction (0-1) of each wait after a failed detection that is randomized")
+	addBackoffFlags("update.backoff", "writing discovered services and functions to storage", &discoveryOpts.UpdateBackoff)
+}
+
+func addBackoffFlags(prefix, description string, policy *backoff.Policy) {
+	defaults := backoff.DefaultPolicy()
+	rootCmd.PersistentFlags().DurationVar(&policy.InitialInterval, prefix+".initial-interval", defaults.InitialInterval, "wait before the first retry when "+description)
+	rootCmd.PersistentFlags().DurationVar(&policy.MaxInterval, prefix+".max-interval", defaults.MaxInterval, "maximum wait between retries when "+description+". 0 means no limit")
+	rootCmd.PersistentFlags().Float64Var(&policy.Multiplier, prefix+".multiplier", defaults.Multiplier, "factor the wait grows by after each retry when "+description)
+	rootCmd.PersistentFlags().Float64Var(&policy.Jitter, prefix+".jitter", defaults.Jitter, "fraction (0-1) of each wait that is randomized when "+description)
+	rootCmd.PersistentFlags().DurationVar(&policy.MaxElapsedTime, prefix+".max-elapsed-time", defaults.MaxElapsedTime, "stop retrying after this long when "+description+". 0 means no limit")
+	rootCmd.PersistentFlags().IntVar(&policy.MaxAttempts, prefix+".max-attempts", defaults.MaxAttempts, "stop retrying after this many attempts when "+description+". 0 means no limit")
 }
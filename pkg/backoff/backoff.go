@@ -1,35 +1,135 @@
 package backoff
 
-import "time"
+import (
+	"context"
+	"math/rand"
+	"time"
+)
 
-// Default values for ExponentialBackOff.
+// Default values for Policy.
 const (
 	defaultInitialInterval = 500 * time.Millisecond
+	defaultMaxInterval     = 30 * time.Second
+	defaultMultiplier      = 2
+	defaultJitter          = 0.2
 	defaultMaxElapsedTime  = 60 * time.Second
 )
 
-func WithBackoff(fn func() error, stop chan struct{}) error {
-	// first try
-	if err := fn(); err == nil {
+// Policy configures how an operation is retried.
+// zero values for MaxInterval, MaxElapsedTime and MaxAttempts mean no limit
+type Policy struct {
+	// wait before the first retry
+	InitialInterval time.Duration
+	// upper bound on the wait between two retries
+	MaxInterval time.Duration
+	// factor the wait grows by after each retry
+	Multiplier float64
+	// fraction of each wait that is randomized, between 0 and 1
+	Jitter float64
+	// give up once this much time has passed since the first attempt
+	MaxElapsedTime time.Duration
+	// give up after this many attempts, including the first
+	MaxAttempts int
+}
+
+func DefaultPolicy() Policy {
+	return Policy{
+		InitialInterval: defaultInitialInterval,
+		MaxInterval:     defaultMaxInterval,
+		Multiplier:      defaultMultiplier,
+		Jitter:          defaultJitter,
+		MaxElapsedTime:  defaultMaxElapsedTime,
+	}
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+// Permanent wraps an error to signal that the operation should not be retried.
+// Retry returns the wrapped error
+func Permanent(err error) error {
+	if err == nil {
 		return nil
 	}
-	tilNextRetry := defaultInitialInterval
-	var elapsed time.Duration
-	for {
+	return &permanentError{err: err}
+}
+
+// Retry calls fn until it succeeds, returns a permanent error, or the policy
+// is exhausted, in which case the last error is returned.
+// If ctx is done before fn succeeds, ctx.Err() is returned
+func Retry(ctx context.Context, policy Policy, fn func() error) error {
+	start := time.Now()
+	interval := policy.InitialInterval
+	for attempt := 1; ; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		if permanent, ok := err.(*permanentError); ok {
+			return permanent.err
+		}
+		if policy.MaxAttempts > 0 && attempt >= policy.MaxAttempts {
+			return err
+		}
+		wait := policy.jitter(interval)
+		if policy.MaxElapsedTime > 0 && time.Since(start)+wait > policy.MaxElapsedTime {
+			return err
+		}
+		timer := time.NewTimer(wait)
 		select {
 		// stopped by another goroutine
-		case <-stop:
-			return nil
-		case <-time.After(tilNextRetry):
-			elapsed += tilNextRetry
-			tilNextRetry *= 2
-			err := fn()
-			if err == nil {
-				return nil
-			}
-			if elapsed >= defaultMaxElapsedTime {
-				return err
-			}
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+		interval = policy.next(interval)
+	}
+}
+
+// Interval returns the wait before the given retry, counting from 1, for
+// callers that schedule retries themselves
+func (p Policy) Interval(retry int) time.Duration {
+	interval := p.InitialInterval
+	for i := 1; i < retry; i++ {
+		next := p.next(interval)
+		// stopped growing, or overflowed
+		if next <= interval {
+			break
 		}
+		interval = next
+	}
+	return p.jitter(interval)
+}
+
+func (p Policy) next(interval time.Duration) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+	next := time.Duration(float64(interval) * multiplier)
+	if p.MaxInterval > 0 && next > p.MaxInterval {
+		next = p.MaxInterval
+	}
+	return next
+}
+
+func (p Policy) jitter(interval time.Duration) time.Duration {
+	if p.Jitter <= 0 {
+		return interval
+	}
+	jitter := p.Jitter
+	if jitter > 1 {
+		jitter = 1
 	}
+	delta := jitter * float64(interval)
+	return time.Duration(float64(interval) - delta + rand.Float64()*2*delta)
 }
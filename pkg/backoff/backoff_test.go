@@ -0,0 +1,84 @@
+package backoff_test
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+
+	. "github.com/solo-io/gloo-function-discovery/pkg/backoff"
+)
+
+var _ = Describe("Retry", func() {
+	policy := Policy{
+		InitialInterval: time.Millisecond,
+		MaxInterval:     5 * time.Millisecond,
+		Multiplier:      2,
+		Jitter:          0.5,
+	}
+	It("retries until fn succeeds", func() {
+		var attempts int
+		err := Retry(context.Background(), policy, func() error {
+			attempts++
+			if attempts < 5 {
+				return errors.New("not yet")
+			}
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(attempts).To(Equal(5))
+	})
+	It("returns the last error once max attempts are reached", func() {
+		p := policy
+		p.MaxAttempts = 3
+		var attempts int
+		err := Retry(context.Background(), p, func() error {
+			attempts++
+			return errors.Errorf("attempt %v", attempts)
+		})
+		Expect(err).To(MatchError("attempt 3"))
+	})
+	It("returns the last error once max elapsed time is reached", func() {
+		p := policy
+		p.MaxElapsedTime = 20 * time.Millisecond
+		err := Retry(context.Background(), p, func() error {
+			return errors.New("never")
+		})
+		Expect(err).To(MatchError("never"))
+	})
+	It("does not retry permanent errors", func() {
+		var attempts int
+		err := Retry(context.Background(), policy, func() error {
+			attempts++
+			return Permanent(errors.New("fatal"))
+		})
+		Expect(err).To(MatchError("fatal"))
+		Expect(attempts).To(Equal(1))
+	})
+	It("returns the context error when canceled", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			cancel()
+		}()
+		err := Retry(ctx, policy, func() error {
+			return errors.New("never")
+		})
+		Expect(err).To(Equal(context.Canceled))
+	})
+})
+
+var _ = Describe("Interval", func() {
+	It("grows the interval with each retry, up to the max", func() {
+		policy := Policy{InitialInterval: time.Second, MaxInterval: 5 * time.Second, Multiplier: 2}
+		Expect(policy.Interval(1)).To(Equal(time.Second))
+		Expect(policy.Interval(3)).To(Equal(4 * time.Second))
+		Expect(policy.Interval(1000)).To(Equal(5 * time.Second))
+	})
+	It("does not overflow without a max interval", func() {
+		policy := Policy{InitialInterval: time.Second, Multiplier: 2}
+		Expect(policy.Interval(1000)).To(BeNumerically(">", time.Hour))
+	})
+})
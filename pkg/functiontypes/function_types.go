@@ -1,33 +1,100 @@
 package functiontypes
 
 import (
+	"sort"
+
+	"github.com/pkg/errors"
 	"github.com/solo-io/gloo-api/pkg/api/types/v1"
-	"github.com/solo-io/gloo-function-discovery/internal/updater/openfaas"
-	"github.com/solo-io/gloo-function-discovery/internal/updater/swagger"
-	"github.com/solo-io/gloo-plugins/aws"
-	"github.com/solo-io/gloo-plugins/google"
+	"github.com/solo-io/gloo/pkg/secretwatcher"
 )
 
-type FunctionType string
+// FunctionSource discovers the functions of one type of upstream,
+// e.g. lambda functions for aws upstreams
+type FunctionSource interface {
+	// unique name of the source, used to enable it by flag
+	Name() string
+	// true if the source discovers functions for the upstream
+	Matches(us *v1.Upstream) bool
+	// refs of the secrets needed to discover functions for the upstream
+	SecretRefs(us *v1.Upstream) []string
+	// the functions currently provided by the upstream
+	GetFuncs(us *v1.Upstream, secrets secretwatcher.SecretMap) ([]*v1.Function, error)
+}
 
-const (
-	FunctionTypeLambda   FunctionType = "functionTypeLambda"
-	FunctionTypeGfuncs   FunctionType = "functionTypeGfuncs"
-	FunctionTypeSwagger  FunctionType = "functionTypeSwagger"
-	FunctionTypeOpenFaas FunctionType = "functionTypeFaas"
-	NonFunctional        FunctionType = "nonFunctional"
-)
+// FileConsumer is implemented by sources that read files from file storage, so that
+// the files are watched and discovery runs again when they change
+type FileConsumer interface {
+	// refs of the files needed to discover functions for the upstream
+	FileRefs(us *v1.Upstream) []string
+}
+
+// GarbageCollector is implemented by sources that keep state for upstreams,
+// so the state can be dropped with the upstreams
+type GarbageCollector interface {
+	// forgets the upstreams that are not in the list
+	CollectGarbage(upstreams []*v1.Upstream)
+}
+
+// Registry holds the enabled function sources, in order of precedence
+type Registry struct {
+	sources []FunctionSource
+}
+
+// NewRegistry registers the sources whose names are in enabled.
+// it is an error to enable a source that does not exist
+func NewRegistry(enabled []string, sources ...FunctionSource) (*Registry, error) {
+	available := make(map[string]FunctionSource)
+	for _, source := range sources {
+		available[source.Name()] = source
+	}
+	enabledSet := make(map[string]bool)
+	for _, name := range enabled {
+		if _, ok := available[name]; !ok {
+			return nil, errors.Errorf("unknown function source %v. available: %v", name, Names(sources))
+		}
+		enabledSet[name] = true
+	}
+	r := &Registry{}
+	for _, source := range sources {
+		if enabledSet[source.Name()] {
+			r.Register(source)
+		}
+	}
+	return r, nil
+}
+
+// Register adds a source with lower precedence than the ones already registered
+func (r *Registry) Register(source FunctionSource) {
+	r.sources = append(r.sources, source)
+}
+
+// SourceFor returns the first source that matches the upstream, or nil if the
+// upstream is not functional
+func (r *Registry) SourceFor(us *v1.Upstream) FunctionSource {
+	for _, source := range r.sources {
+		if source.Matches(us) {
+			return source
+		}
+	}
+	return nil
+}
+
+// CollectGarbage lets the sources forget about upstreams that are not in the list,
+// which must contain every upstream
+func (r *Registry) CollectGarbage(upstreams []*v1.Upstream) {
+	for _, source := range r.sources {
+		if collector, ok := source.(GarbageCollector); ok {
+			collector.CollectGarbage(upstreams)
+		}
+	}
+}
 
-func GetFunctionType(us *v1.Upstream) FunctionType {
-	switch {
-	case us.Type == aws.UpstreamTypeAws:
-		return FunctionTypeLambda
-	case us.Type == gfunc.UpstreamTypeGoogle:
-		return FunctionTypeGfuncs
-	case swagger.IsSwagger(us):
-		return FunctionTypeSwagger
-	case openfaas.IsOpenFaas(us):
-		return FunctionTypeOpenFaas
+// Names returns the sorted names of the given sources
+func Names(sources []FunctionSource) []string {
+	var names []string
+	for _, source := range sources {
+		names = append(names, source.Name())
 	}
-	return NonFunctional
+	sort.Strings(names)
+	return names
 }
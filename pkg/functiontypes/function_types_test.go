@@ -0,0 +1,55 @@
+package functiontypes_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/solo-io/gloo-api/pkg/api/types/v1"
+	. "github.com/solo-io/gloo-function-discovery/pkg/functiontypes"
+	"github.com/solo-io/gloo/pkg/secretwatcher"
+)
+
+type mockSource struct {
+	name         string
+	upstreamType string
+}
+
+func (s *mockSource) Name() string                        { return s.name }
+func (s *mockSource) Matches(us *v1.Upstream) bool        { return us.Type == s.upstreamType }
+func (s *mockSource) SecretRefs(us *v1.Upstream) []string { return nil }
+func (s *mockSource) GetFuncs(us *v1.Upstream, secrets secretwatcher.SecretMap) ([]*v1.Function, error) {
+	return []*v1.Function{{Name: s.name}}, nil
+}
+
+type collectingSource struct {
+	mockSource
+	collected []*v1.Upstream
+}
+
+func (s *collectingSource) CollectGarbage(upstreams []*v1.Upstream) { s.collected = upstreams }
+
+var _ = Describe("Registry", func() {
+	first := &mockSource{name: "first", upstreamType: "a"}
+	second := &mockSource{name: "second", upstreamType: "a"}
+	other := &mockSource{name: "other", upstreamType: "b"}
+
+	It("returns the first enabled source matching the upstream", func() {
+		r, err := NewRegistry([]string{"second", "other"}, first, second, other)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.SourceFor(&v1.Upstream{Type: "a"})).To(Equal(second))
+		Expect(r.SourceFor(&v1.Upstream{Type: "b"})).To(Equal(other))
+		Expect(r.SourceFor(&v1.Upstream{Type: "c"})).To(BeNil())
+	})
+	It("rejects unknown sources", func() {
+		_, err := NewRegistry([]string{"missing"}, first, other)
+		Expect(err).To(MatchError(ContainSubstring("unknown function source missing")))
+	})
+	It("passes the upstreams to the sources collecting garbage", func() {
+		collecting := &collectingSource{mockSource: mockSource{name: "collecting", upstreamType: "c"}}
+		r, err := NewRegistry([]string{"first", "collecting"}, first, collecting)
+		Expect(err).NotTo(HaveOccurred())
+		upstreams := []*v1.Upstream{{Name: "remaining"}}
+		r.CollectGarbage(upstreams)
+		Expect(collecting.collected).To(Equal(upstreams))
+	})
+})
@@ -0,0 +1,13 @@
+package functiontypes_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestFunctionTypes(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "FunctionTypes Suite")
+}